@@ -32,6 +32,15 @@ const (
 //     ebv_column (Economic block value column, 1 indexed)
 //   2 (GZIP .gz file, only ebv, one column, no header)
 //     grid (as above)
+//   3 (CSV file with a header, may be gzipped, need not list every block)
+//     grid (as above)
+//     csv
+//       x, y, z (Coordinate column names) or
+//       i, j, k (Block index column names)
+//       index_base (0 or 1, the index of the first block)
+//       values (EBV column names, one per realization)
+//       default (EBV of the blocks not in the file)
+//       delimiter (Default ",")
 \"input\" : {
   \"type\" : 1,
 
@@ -47,6 +56,19 @@ const (
 //   1 (Benches)
 //     slope (The slope (in degrees))
 //     benches (The number of benches)
+//   2 (Slope sectors)
+//     sectors (List of azimuth and slope pairs, in degrees. Azimuths are
+//              clockwise from north, slopes are interpolated between them)
+//     benches (as above)
+//   3 (Geotechnical zones)
+//     zones
+//       column (Zone code column of a type 1 input, 1 indexed) or
+//       file (One zone code per line in grid order, may be gzipped)
+//       slopes (List of code with a slope or with sectors, as above)
+//     benches (as above)
+//   4 (1:5 pattern, the block above and its four neighbours)
+//   5 (1:9 pattern, the 3x3 blocks above)
+//   6 (Knight's move, 1:5 and 1:9 alternating by bench)
 \"precedence\" : {
   \"method\" : 1,
 
@@ -58,8 +80,121 @@ const (
 //   1 (Lerchs Grossmann)
 //   2 (Dimacs program)
 //     dimacs_path (Path to engine)
+//     precision (EBV scaling before truncating to integers, default 1e6)
+//   3 (Pseudoflow)
+//     precision (as above)
+//   4 (Max flow, float64 EBVs, no scaling)
 \"optimization\" : {
   \"engine\" : 1
+},
+
+// shells (Optional nested pits, the output is the first shell mining a block)
+//   revenue_factors (Multipliers of the positive EBVs, one pit each)
+//   density (Tonnes per unit volume, for the shell summary)
+\"shells\" : {
+  \"revenue_factors\" : [],
+  \"density\" : 1.0
+},
+
+// phases (Optional pushbacks grouped from the shells, the output is the
+//         phase mining a block)
+//   count (The number of phases)
+//   tonnage (Target tonnes per phase, default the total over the count)
+//   min_width (Minimum width of a phase beyond the one before, in metres)
+//   Tonnes and ore are those of the schedule.
+\"phases\" : {
+  \"count\" : 0,
+  \"tonnage\" : 0.0,
+  \"min_width\" : 0.0
+},
+
+// schedule (Optional periods of the pit, shells or phases, the output is
+//           the period mining a block)
+//   mining_capacity, processing_capacity (Tonnes per period, processing
+//                                         for the ore)
+//   periods (The most periods, default as many as needed)
+//   discount_rate (Per period)
+//   improvements (Passes improving the NPV after the first schedule)
+//   Tonnes and ore come from the economics, or from the shell density and
+//   the blocks of positive EBV. Air, above the topography or of no EBV,
+//   has no tonnes.
+\"schedule\" : {
+  \"mining_capacity\" : 0.0,
+  \"processing_capacity\" : 0.0,
+  \"periods\" : 0,
+  \"discount_rate\" : 0.1,
+  \"improvements\" : 0
+},
+
+// stochastic (Optional, a single pit for every realization)
+//   objective
+//     1 (Expected value, the mean over the realizations)
+//     2 (Downside, the mean less lambda times the mean shortfall below it)
+//       lambda (The weight of the shortfall)
+//       iterations (Reweightings of the realizations, default 20)
+//     3 (CVaR, the mean of the worst realizations)
+//       alpha (Part of the realizations that are the worst, default 0.1)
+//       iterations (Reweightings of the realizations, default 20)
+\"stochastic\" : {
+  \"objective\" : 0
+},
+
+// discount (Optional, the pit of the discounted EBVs, not with shells)
+//   rate (Per year)
+//   advance_rate (Metres a year the pit deepens, the time of a block is
+//                 its depth below the top of its column over this)
+//   iterations (Times the pit is scheduled and solved again with the
+//               period of each block as its time in years, needs the
+//               schedule)
+\"discount\" : {
+  \"rate\" : 0.0,
+  \"advance_rate\" : 50.0,
+  \"iterations\" : 0
+},
+
+// constraints (Optional)
+//   exclude (Blocks never mined, nor those below that need them)
+//   include (Blocks always mined, and those above they need)
+//     blocks (Grid indices, x fastest then y then z, 0 indexed)
+//     polygons (Lists of [x, y] vertices, on every bench)
+//     boxes ([min x, min y, min z, max x, max y, max z])
+//   A block is in a polygon or box if its centroid is.
+\"constraints\" : {
+  \"exclude\" : { \"blocks\" : [], \"polygons\" : [], \"boxes\" : [] },
+  \"include\" : { \"blocks\" : [], \"polygons\" : [], \"boxes\" : [] }
+},
+
+// output
+//   format
+//     1 (Plain, space separated, no header)
+//     2 (GEOEAS (GSLIB), with a header)
+//     3 (CSV, with a header line)
+//   columns (Any of x, y, z (block centroid), realization, pit, shell,
+//            ebv and probability. Default the pit, or the shell)
+//   sparse (Only the mined blocks, needs x, y and z)
+\"output\" : {
+  \"format\" : 1,
+  \"columns\" : [],
+  \"sparse\" : false
+},
+
+// economics (Optional, calculates the EBVs from a type 1 input)
+//   tonnage_column (Tonnes per block, 1 indexed) or
+//   density_column (Density per block, 1 indexed) or
+//   density (Constant density)
+//   mining_cost, processing_cost (Per tonne)
+//   grades (One per metal)
+//     column (Grade column, 1 indexed)
+//     price, selling_cost (Per unit of metal)
+//     recovery (Between 0 and 1)
+//     units (Grade divisor, 100 for percent)
+//   Blocks are processed when that is worth more than dumping them.
+\"economics\" : {
+  \"tonnage_column\" : 0,
+  \"density\" : 2.7,
+  \"mining_cost\" : 2.0,
+  \"processing_cost\" : 10.0,
+  \"grades\" : []
 }
 }`
 )
@@ -0,0 +1,66 @@
+// Copyright © 2017 Robert Wright a1210993@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/cihub/seelog"
+	"github.com/qarth/CloudPit/optimization"
+	"github.com/spf13/cobra"
+)
+
+var precedenceCheckCmd = &cobra.Command{
+	Use:   "precedence-check parameter_file",
+	Short: "Compare the precedence with the exact slope",
+	Long: `Compare the precedence with the exact slope.
+
+For the grid and precedence of the parameter file, report the blocks the
+chained templates miss and add compared with the exact cone, at every level
+beyond the number of benches, and recommend a number of benches.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(EXIT_USAGE)
+		}
+
+		depth, _ := cmd.Flags().GetInt("depth")
+		tolerance, _ := cmd.Flags().GetFloat64("tolerance")
+
+		// The templates log their sizes, only the report is wanted
+		log.ReplaceLogger(log.Disabled)
+
+		e := optimization.CheckPrecedence(optimization.PrecedenceCheckParams{
+			ParamFile: args[0],
+			Depth:     depth,
+			Tolerance: tolerance,
+		}, os.Stdout)
+
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(exitCode(e))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(precedenceCheckCmd)
+
+	flagset := precedenceCheckCmd.Flags()
+	flagset.Int("depth", optimization.DEFAULT_CHECK_DEPTH, "The deepest level checked, in benches")
+	flagset.Float64("tolerance", optimization.DEFAULT_CHECK_TOLERANCE, "Error (in percent) allowed above the best number of benches")
+}
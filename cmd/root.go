@@ -15,8 +15,11 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
@@ -39,11 +42,26 @@ const (
 	log_file_tmpl = `<rollingfile filename="%s" type="size" maxsize="10247680" maxrolls="10"/>`
 )
 
+// Exit codes, one for each kind of error returned by the optimization
+const (
+	EXIT_OK = iota
+	EXIT_USAGE
+	EXIT_PARAMETERS
+	EXIT_INPUT
+	EXIT_ENGINE
+	EXIT_SOLVER
+	EXIT_OUTPUT
+	EXIT_UNKNOWN
+	EXIT_TIMEOUT
+	EXIT_INTERRUPTED
+)
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "CloudPit",
 	Short: fmt.Sprintf("%v %v %v", PROGRAM_NAME, PROGRAM_VERSION, COPYRIGHT),
 	Long:  fmt.Sprintf("Usage: %s [options] parameter_file", PROGRAM_NAME),
+	Args:  cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		doMiningOperation(cmd, args)
 	},
@@ -54,7 +72,7 @@ var RootCmd = &cobra.Command{
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(-1)
+		os.Exit(EXIT_USAGE)
 	}
 }
 
@@ -66,6 +84,16 @@ func init() {
 	flagset.StringP("input", "i", "", "The input file")
 	flagset.StringP("output", "o", "", "The output file")
 	flagset.StringP("log", "l", "", "Log information to a file")
+
+	RootCmd.Flags().Duration("timeout", 0, "Abort if not finished within the duration, e.g. 90s or 2h")
+	RootCmd.Flags().Duration("progress", optimization.DEFAULT_PROGRESS_INTERVAL, "Log the progress of the solver this often, 0 for never")
+	RootCmd.Flags().Int("workers", 1, "Realizations solved at once")
+	RootCmd.Flags().Int64("memory", 0, "Megabytes the workers may use, GOMEMLIMIT if not given")
+	RootCmd.Flags().Bool("probability", false, "Add the probability of mining each block to the output columns, and log the guaranteed and possible pits")
+	RootCmd.Flags().String("surface", "", "Also write the pit surface to this file, .asc, .xyz, .obj or .stl, numbered by realization")
+	RootCmd.Flags().String("mesh", "", "Also write the boundary of the pit or shells to this file, .obj, .ply or .vtk, numbered by realization and shell")
+	RootCmd.Flags().Int("mesh-smoothing", 0, "Iterations of Laplacian smoothing of the mesh, each vertex moving half a block at most")
+	RootCmd.Flags().String("topography", "", "The current surface, .asc or .xyz, the blocks above it are already mined")
 }
 
 func doMiningOperation(cmd *cobra.Command, args []string) {
@@ -75,10 +103,19 @@ func doMiningOperation(cmd *cobra.Command, args []string) {
 	logfile := viper.GetString("log")
 	infile := viper.GetString("input")
 	outfile := viper.GetString("output")
+	timeout := viper.GetDuration("timeout")
+	interval := viper.GetDuration("progress")
+	workers := viper.GetInt("workers")
+	memory := viper.GetInt64("memory")
+	probability := viper.GetBool("probability")
+	surface := viper.GetString("surface")
+	mesh := viper.GetString("mesh")
+	smoothing := viper.GetInt("mesh-smoothing")
+	topography := viper.GetString("topography")
 
 	if len(infile) == 0 || len(outfile) == 0 || len(args) != 1 {
 		cmd.Usage()
-		return
+		os.Exit(EXIT_USAGE)
 	}
 
 	//-------
@@ -100,14 +137,107 @@ func doMiningOperation(cmd *cobra.Command, args []string) {
 	//-------
 
 	param := optimization.MiningOptParams{
-		InputFile:  infile,
-		OutputFile: outfile,
-		ParamFile:  args[0],
+		InputFile:      infile,
+		OutputFile:     outfile,
+		ParamFile:      args[0],
+		Workers:        workers,
+		MemoryLimit:    memory << 20,
+		Probability:    probability,
+		SurfaceFile:    surface,
+		MeshFile:       mesh,
+		MeshSmoothing:  smoothing,
+		TopographyFile: topography,
+	}
+
+	if interval > 0 {
+		param.Progress = logProgress
+		param.ProgressInterval = interval
+	}
+
+	// Interrupting aborts cleanly, without writing the output
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	log.Info("ultpit begin")
-	optimization.DoMiningOptimization(param)
+	e := optimization.DoMiningOptimizationContext(ctx, param)
+
+	if errors.Is(e, context.DeadlineExceeded) {
+		log.Errorf("ERROR: aborted after %v", timeout)
+	} else if errors.Is(e, context.Canceled) {
+		log.Error("ERROR: interrupted")
+	}
+
 	log.Info("ultpit finished")
 
-	time.Sleep(time.Millisecond * 300)
+	log.Flush()
+
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(exitCode(e))
+	}
+}
+
+func logProgress(p optimization.Progress) {
+
+	line := fmt.Sprintf("Progress: solve %v of %v, %v", p.Solve, p.Solves, p.Stage)
+
+	if p.Pass > 0 {
+		line += fmt.Sprintf(", pass %v", p.Pass)
+	}
+	if p.ArcsAdded > 0 {
+		line += fmt.Sprintf(", arcs added %v", p.ArcsAdded)
+	}
+	if p.Strong > 0 || p.Weak > 0 {
+		line += fmt.Sprintf(", strong %v, weak %v", p.Strong, p.Weak)
+	}
+	if p.Value != 0 {
+		line += fmt.Sprintf(", value %f", p.Value)
+	}
+
+	line += fmt.Sprintf(", elapsed %v", p.Elapsed.Round(time.Second))
+
+	if p.Remaining >= 0 {
+		line += fmt.Sprintf(", ETA %v", p.Remaining.Round(time.Second))
+	} else {
+		line += ", ETA unknown"
+	}
+
+	log.Info(line)
+}
+
+// The exit code for the kind of error
+func exitCode(e error) int {
+
+	var parameterError *optimization.ParameterError
+	var inputError *optimization.InputError
+	var engineError *optimization.EngineError
+	var solverError *optimization.SolverError
+	var outputError *optimization.OutputError
+
+	switch {
+	case e == nil:
+		return EXIT_OK
+	case errors.Is(e, context.DeadlineExceeded):
+		return EXIT_TIMEOUT
+	case errors.Is(e, context.Canceled):
+		return EXIT_INTERRUPTED
+	case errors.As(e, &parameterError):
+		return EXIT_PARAMETERS
+	case errors.As(e, &inputError):
+		return EXIT_INPUT
+	case errors.As(e, &engineError):
+		return EXIT_ENGINE
+	case errors.As(e, &solverError):
+		return EXIT_SOLVER
+	case errors.As(e, &outputError):
+		return EXIT_OUTPUT
+	default:
+		return EXIT_UNKNOWN
+	}
 }
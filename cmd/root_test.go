@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/qarth/CloudPit/optimization"
+)
+
+// Each kind of error exits with its own code, even when wrapped
+func TestExitCode(t *testing.T) {
+
+	cause := fmt.Errorf("ERROR: cause")
+
+	tests := []struct {
+		e    error
+		code int
+	}{
+		{nil, EXIT_OK},
+		{&optimization.ParameterError{Err: cause}, EXIT_PARAMETERS},
+		{&optimization.InputError{Err: cause}, EXIT_INPUT},
+		{&optimization.EngineError{Err: cause}, EXIT_ENGINE},
+		{&optimization.SolverError{Err: cause}, EXIT_SOLVER},
+		{&optimization.OutputError{Err: cause}, EXIT_OUTPUT},
+		{fmt.Errorf("wrapped: %w", &optimization.InputError{Err: cause}), EXIT_INPUT},
+		{context.DeadlineExceeded, EXIT_TIMEOUT},
+		{context.Canceled, EXIT_INTERRUPTED},
+		{&optimization.SolverError{Err: context.DeadlineExceeded}, EXIT_TIMEOUT},
+		{cause, EXIT_UNKNOWN},
+	}
+
+	for _, test := range tests {
+		if code := exitCode(test.e); code != test.code {
+			t.Errorf("%v exits with %v, want %v", test.e, code, test.code)
+		}
+	}
+}
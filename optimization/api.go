@@ -0,0 +1,185 @@
+package optimization
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// A block model held in memory. Values holds the EBV of every block for
+	// each realization, in grid order (see Grid.Index). The values are only
+	// read while optimizing, so they must not change until it returns. The
+	// grid's MinX, MinY and MinZ are the centroid of the first block, as in
+	// GSLIB and CSV files.
+	BlockModel struct {
+		Grid   Grid
+		Values [][]float64
+	}
+
+	// What to optimize the block model with. The precedence and engine are
+	// the same as the "precedence" and "optimization" parameters, zones take
+	// their codes from Precedence.Zones.Codes.
+	Options struct {
+		Precedence       Precedence
+		Engine           EngineParam
+		Stochastic       StochasticParam // A single pit for every realization, if an objective is given
+		Discount         DiscountParam   // Discounted values by the depth of the blocks, if a rate is given, without iterations
+		Constraints      ConstraintParam // Blocks that must not, or must, be mined
+		Topography       []float64       // The elevation of each column, x fastest, the blocks above it are air
+		Progress         ProgressFunc    // Called with the progress of the engines, if any
+		ProgressInterval time.Duration   // Between calls, DEFAULT_PROGRESS_INTERVAL if not positive
+		Workers          int             // Realizations solved at once, at least 1
+		MemoryLimit      int64           // Bytes the workers may use, GOMEMLIMIT if not positive
+	}
+
+	// The pit of one realization. A stochastic pit has the mean values.
+	Pit struct {
+		Selected   []bool  // One per block of the grid
+		Blocks     int64   // Number of blocks selected
+		Value      float64 // Sum of the values of the selected blocks
+		Discounted float64 // Sum of their discounted values, if discounted
+	}
+
+	Statistics struct {
+		Blocks      int   // Blocks in the grid
+		Solved      int   // Blocks left for the engine after masking
+		Arcs        int64 // Precedence arcs given to the engine
+		Definitions int   // Different precedence definitions
+		Elapsed     time.Duration
+	}
+
+	Result struct {
+		Pits       []Pit     // One per realization, or the single stochastic pit
+		Values     []float64 // Stochastic: the value of the pit in each realization
+		Statistics Statistics
+	}
+)
+
+// A block model of the grid with one slice of values per realization
+func NewBlockModel(grid Grid, values ...[]float64) (*BlockModel, error) {
+
+	model := &BlockModel{Grid: grid, Values: values}
+
+	if e := model.validate(); e != nil {
+		return nil, e
+	}
+
+	return model, nil
+}
+
+func (this *BlockModel) validate() error {
+
+	var e error
+
+	if e = this.Grid.validate(); e == nil {
+		if len(this.Values) == 0 {
+			e = fmt.Errorf("ERROR: no realizations")
+		} else {
+			for r, v := range this.Values {
+				if len(v) != this.Grid.gridCount() {
+					e = fmt.Errorf("ERROR: realization %v has %v values, grid has %v blocks", r, len(v), this.Grid.gridCount())
+					break
+				}
+			}
+		}
+	}
+
+	if e != nil {
+		log.Error(e)
+		return &InputError{e}
+	}
+
+	return nil
+}
+
+// Find the ultimate pit of every realization of the block model. Neither
+// the model nor the options are changed, values that differ, such as those
+// made air by the topography, are copies. The error is one of
+// ParameterError, InputError, EngineError or SolverError.
+func Optimize(model *BlockModel, opt Options) (*Result, error) {
+	return OptimizeContext(context.Background(), model, opt)
+}
+
+// As Optimize, but stops when the context ends and returns its error
+func OptimizeContext(ctx context.Context, model *BlockModel, opt Options) (*Result, error) {
+
+	if model == nil {
+		e := fmt.Errorf("ERROR: no block model")
+		log.Error(e)
+		return nil, &InputError{e}
+	} else if e := model.validate(); e != nil {
+		return nil, e
+	}
+
+	// The discount iterations schedule the pits, and there is no schedule
+	if opt.Discount.Iterations > 0 {
+		e := fmt.Errorf("ERROR: discount iterations need a schedule, which the options do not have")
+		log.Error(e)
+		return nil, &ParameterError{e}
+	}
+
+	// The realizations are shared, but the slice of them is not, so
+	// replacing one leaves the model alone
+	values := make([][]float64, len(model.Values))
+	copy(values, model.Values)
+
+	// The grid is a copy with its origin moved to the corner of the first
+	// block, as when reading a GSLIB or CSV file
+	grid := model.Grid
+	grid.adjust4gslib()
+
+	params := Parameters{
+		Input:       Data{Grid: grid, Ebv: values},
+		Precedence:  opt.Precedence,
+		EngineParam: opt.Engine,
+		Stochastic:  opt.Stochastic,
+		Discount:    opt.Discount,
+		Constraints: opt.Constraints,
+		progress:    newProgressReporter(opt.Progress, opt.ProgressInterval),
+		workers:     opt.Workers,
+		memoryLimit: opt.MemoryLimit,
+	}
+
+	if len(opt.Topography) > 0 {
+		if e := params.Input.setTopography(opt.Topography); e != nil {
+			return nil, e
+		}
+	}
+
+	return params.optimizing(ctx)
+}
+
+func newPit(selected []bool, values []float64) Pit {
+
+	pit := Pit{Selected: selected}
+
+	for i, v := range selected {
+		if v {
+			pit.Blocks++
+			pit.Value += values[i]
+		}
+	}
+
+	return pit
+}
+
+// The statistics of a condensed precedence
+func (this *Precedence) statistics(blocks int) Statistics {
+
+	stats := Statistics{
+		Blocks:      blocks,
+		Solved:      len(this.keys),
+		Definitions: len(this.defs),
+	}
+
+	for _, key := range this.keys {
+		if key != MISSING {
+			stats.Arcs += int64(len(this.defs[key]))
+		}
+	}
+
+	return stats
+}
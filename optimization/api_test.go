@@ -0,0 +1,81 @@
+package optimization
+
+import (
+	"errors"
+	"testing"
+)
+
+// The topography makes blocks air in a copy, the model keeps its values
+func TestOptimizeKeepsModel(t *testing.T) {
+
+	grid := Grid{NumX: 1, NumY: 1, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}
+	layer := []float64{5, -1, 3}
+
+	model, e := NewBlockModel(grid, layer)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	opt := Options{
+		Precedence: Precedence{Method: PATTERN_1_5},
+		Engine:     EngineParam{EngineType: 1},
+		Topography: []float64{15},
+	}
+
+	result, e := Optimize(model, opt)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if &model.Values[0][0] != &layer[0] || layer[2] != 3 {
+		t.Errorf("model values changed to %v", model.Values)
+	}
+
+	// The top block is air, the two below are worth 4
+	if result.Pits[0].Value != 4 {
+		t.Errorf("pit value %v, want 4", result.Pits[0].Value)
+	}
+
+	opt.Topography = nil
+	opt.Discount = DiscountParam{Rate: 0.1, AdvanceRate: 10, Iterations: 1}
+
+	var param *ParameterError
+	if _, e := Optimize(model, opt); !errors.As(e, &param) {
+		t.Errorf("got %v, want a ParameterError for discount iterations", e)
+	}
+}
+
+// The grid's minimum is the centroid of the first block, as in the files
+func TestOptimizeGridCentroid(t *testing.T) {
+
+	// Centroids at 5, 15 and 25, the surface is above the middle one
+	grid := Grid{NumX: 1, NumY: 1, NumZ: 3, MinZ: 5, SizX: 10, SizY: 10, SizZ: 10}
+
+	model, e := NewBlockModel(grid, []float64{5, -1, 3})
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	opt := Options{
+		Precedence: Precedence{Method: PATTERN_1_5},
+		Engine:     EngineParam{EngineType: 1},
+		Topography: []float64{18},
+	}
+
+	result, e := Optimize(model, opt)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if result.Pits[0].Value != 4 {
+		t.Errorf("pit value %v, want 4 with only the top block air", result.Pits[0].Value)
+	}
+
+	if model.Grid.MinZ != 5 {
+		t.Errorf("model grid moved to %v", model.Grid.MinZ)
+	}
+}
@@ -0,0 +1,200 @@
+package optimization
+
+import (
+	"fmt"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// Blocks by their grid index (see Grid.Index), by polygons in XY that
+	// take every bench, or by boxes of min x, y, z then max x, y, z. A block
+	// is in a polygon or box if its centroid is.
+	RegionParam struct {
+		Blocks   []int          `json:"blocks"`
+		Polygons [][][2]float64 `json:"polygons"`
+		Boxes    [][6]float64   `json:"boxes"`
+	}
+
+	// Blocks that must not be mined, with every block below that needs
+	// them, and blocks that must be, with every block above they need
+	ConstraintParam struct {
+		Exclude RegionParam `json:"exclude"`
+		Include RegionParam `json:"include"`
+	}
+)
+
+// True if the region has any blocks, polygons or boxes
+func (this *RegionParam) enabled() bool {
+	return len(this.Blocks) > 0 || len(this.Polygons) > 0 || len(this.Boxes) > 0
+}
+
+func (this *RegionParam) check(grid *Grid) error {
+
+	for _, k := range this.Blocks {
+		if k < 0 || k >= grid.gridCount() {
+			return fmt.Errorf("ERROR: block %v is not in the grid of %v blocks", k, grid.gridCount())
+		}
+	}
+
+	for p, polygon := range this.Polygons {
+		if len(polygon) < 3 {
+			return fmt.Errorf("ERROR: polygon %v has %v vertices, it needs at least 3", p, len(polygon))
+		}
+	}
+
+	for b, box := range this.Boxes {
+		if box[0] > box[3] || box[1] > box[4] || box[2] > box[5] {
+			return fmt.Errorf("ERROR: box %v has a minimum above its maximum", b)
+		}
+	}
+
+	return nil
+}
+
+// The blocks of the grid in the region
+func (this *RegionParam) blocks(grid *Grid) []bool {
+
+	in := make([]bool, grid.gridCount())
+
+	for _, k := range this.Blocks {
+		in[k] = true
+	}
+
+	if len(this.Polygons) == 0 && len(this.Boxes) == 0 {
+		return in
+	}
+
+	for k := range in {
+
+		if in[k] {
+			continue
+		}
+
+		c := grid.blockCentroid2(k)
+
+		for _, polygon := range this.Polygons {
+			if inPolygon(polygon, c[0], c[1]) {
+				in[k] = true
+				break
+			}
+		}
+
+		for _, box := range this.Boxes {
+			if box[0] <= c[0] && c[0] <= box[3] && box[1] <= c[1] && c[1] <= box[4] && box[2] <= c[2] && c[2] <= box[5] {
+				in[k] = true
+				break
+			}
+		}
+	}
+
+	return in
+}
+
+// True if the point is inside the polygon, by the crossings of a ray
+// towards +x
+func inPolygon(polygon [][2]float64, x, y float64) bool {
+
+	inside := false
+
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a[1] > y) != (b[1] > y) && x < a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// The blocks excluded and included by the regions, nil if there are none
+func (this *ConstraintParam) regions(grid *Grid) ([]bool, []bool, error) {
+
+	var excluded, included []bool
+
+	for _, region := range []*RegionParam{&this.Exclude, &this.Include} {
+		if e := region.check(grid); e != nil {
+			log.Error(e)
+			return nil, nil, &ParameterError{e}
+		}
+	}
+
+	if this.Exclude.enabled() {
+		excluded = this.Exclude.blocks(grid)
+	}
+
+	if this.Include.enabled() {
+		included = this.Include.blocks(grid)
+	}
+
+	return excluded, included, nil
+}
+
+// Take the excluded blocks and those below that need them out of the
+// mask, and the included blocks and those above they need too, keeping
+// them to be added to every pit. The mask and the precedence must be
+// closed, the predecessors of every block in the mask in it too.
+func (ctx *Parameters) constrain(mask, excluded, included []bool) error {
+
+	keys, defs := ctx.Precedence.keys, ctx.Precedence.defs
+
+	// The predecessors are above, at higher indices, so they are settled
+	// first going down and last going up
+	var out int
+	if excluded != nil {
+		for i := len(mask) - 1; i >= 0; i-- {
+			if mask[i] && !excluded[i] {
+				if key := keys[i]; key != MISSING {
+					for _, off := range defs[key] {
+						if excluded[i+off] {
+							excluded[i] = true
+							break
+						}
+					}
+				}
+			}
+			if excluded[i] {
+				out++
+			}
+		}
+	}
+
+	var in int
+	if included != nil {
+		for i := range mask {
+			if included[i] {
+				if key := keys[i]; key != MISSING {
+					for _, off := range defs[key] {
+						included[i+off] = true
+					}
+				}
+				in++
+			}
+		}
+	}
+
+	for i := range mask {
+		if excluded != nil && excluded[i] {
+			if included != nil && included[i] {
+				e := fmt.Errorf("ERROR: block %v must be mined, but is excluded or needs an excluded block", i)
+				log.Error(e)
+				return &ParameterError{e}
+			}
+			mask[i] = false
+		} else if included != nil && included[i] {
+			mask[i] = false
+		}
+	}
+
+	if excluded != nil {
+		log.Infof("Excluded %v blocks, with those below that need them", out)
+	}
+
+	if included != nil {
+		log.Infof("Included %v blocks, with those above they need", in)
+	}
+
+	ctx.included = included
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package optimization
+
+import (
+	"testing"
+)
+
+// A 5 by 1 by 3 grid with the blocks above each within 45 degrees, every
+// block in the mask
+func constraintTestParams(t *testing.T) (*Parameters, []bool) {
+
+	ctx := &Parameters{
+		Input:      Data{Grid: Grid{NumX: 5, NumY: 1, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}},
+		Precedence: Precedence{Method: BENCH, Slope: 45, NumBenches: 1},
+	}
+
+	mask := make([]bool, ctx.Input.Grid.gridCount())
+	for i := range mask {
+		mask[i] = true
+	}
+
+	if e := ctx.Precedence.init(ctx, mask); e != nil {
+		t.Fatal(e)
+	}
+
+	return ctx, mask
+}
+
+// The blocks in a region, as ix, iz pairs
+func constraintBlocks(grid *Grid, blocks ...[2]int) []bool {
+
+	in := make([]bool, grid.gridCount())
+	for _, b := range blocks {
+		in[grid.gridIndex(b[0], 0, b[1])] = true
+	}
+
+	return in
+}
+
+func checkBlocks(t *testing.T, name string, grid *Grid, got []bool, want ...[2]int) {
+
+	expected := constraintBlocks(grid, want...)
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("%v: block %v, %v is %v, want %v", name, grid.gridIx(i), grid.gridIz(i), got[i], expected[i])
+		}
+	}
+}
+
+// Excluding a block at the top takes the cone below it that needs it
+func TestConstrainExclude(t *testing.T) {
+
+	ctx, mask := constraintTestParams(t)
+	grid := &ctx.Input.Grid
+
+	if e := ctx.constrain(mask, constraintBlocks(grid, [2]int{2, 2}), nil); e != nil {
+		t.Fatal(e)
+	}
+
+	out := make([]bool, len(mask))
+	for i, m := range mask {
+		out[i] = !m
+	}
+
+	checkBlocks(t, "excluded", grid, out,
+		[2]int{2, 2},
+		[2]int{1, 1}, [2]int{2, 1}, [2]int{3, 1},
+		[2]int{0, 0}, [2]int{1, 0}, [2]int{2, 0}, [2]int{3, 0}, [2]int{4, 0},
+	)
+
+	if ctx.included != nil {
+		t.Errorf("included %v without an include region", ctx.included)
+	}
+}
+
+// Including a block at the bottom takes the cone above it that it needs,
+// out of the mask and into every pit
+func TestConstrainInclude(t *testing.T) {
+
+	ctx, mask := constraintTestParams(t)
+	grid := &ctx.Input.Grid
+
+	if e := ctx.constrain(mask, nil, constraintBlocks(grid, [2]int{0, 0})); e != nil {
+		t.Fatal(e)
+	}
+
+	cone := [][2]int{{0, 0}, {0, 1}, {1, 1}, {0, 2}, {1, 2}, {2, 2}}
+
+	checkBlocks(t, "included", grid, ctx.included, cone...)
+
+	for i, m := range mask {
+		if m == ctx.included[i] {
+			t.Errorf("block %v is in the mask %v and included %v", i, m, ctx.included[i])
+		}
+	}
+}
+
+// A block cannot be included if it needs an excluded one
+func TestConstrainConflict(t *testing.T) {
+
+	ctx, mask := constraintTestParams(t)
+	grid := &ctx.Input.Grid
+
+	e := ctx.constrain(mask, constraintBlocks(grid, [2]int{1, 2}), constraintBlocks(grid, [2]int{0, 0}))
+
+	if _, ok := e.(*ParameterError); !ok {
+		t.Errorf("got %v, want a ParameterError", e)
+	}
+}
+
+// Regions by index, polygon and box, by the centroids of the blocks
+func TestRegionBlocks(t *testing.T) {
+
+	grid := &Grid{NumX: 5, NumY: 1, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}
+
+	region := RegionParam{
+		Blocks: []int{grid.gridIndex(4, 0, 2)},
+		// Every bench of the first two columns
+		Polygons: [][][2]float64{{{0, 0}, {20, 0}, {20, 10}, {0, 10}}},
+		// The middle block of the bottom bench
+		Boxes: [][6]float64{{20, 0, 0, 30, 10, 10}},
+	}
+
+	if e := region.check(grid); e != nil {
+		t.Fatal(e)
+	}
+
+	checkBlocks(t, "region", grid, region.blocks(grid),
+		[2]int{4, 2}, [2]int{2, 0},
+		[2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1}, [2]int{0, 2}, [2]int{1, 2},
+	)
+
+	bad := []RegionParam{
+		{Blocks: []int{15}},
+		{Polygons: [][][2]float64{{{0, 0}, {1, 1}}}},
+		{Boxes: [][6]float64{{1, 0, 0, 0, 1, 1}}},
+	}
+
+	for _, region := range bad {
+		if region.check(grid) == nil {
+			t.Errorf("%+v accepted", region)
+		}
+	}
+}
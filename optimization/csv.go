@@ -0,0 +1,276 @@
+package optimization
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// A CSV block model with a header. Blocks are located by the x, y and z
+	// coordinate columns, or by the i, j and k index columns counted from
+	// IndexBase. Each of the Values columns is one realization. Blocks that
+	// are not in the file, such as air, take the Default value.
+	CsvParam struct {
+		X         string   `json:"x"`
+		Y         string   `json:"y"`
+		Z         string   `json:"z"`
+		I         string   `json:"i"`
+		J         string   `json:"j"`
+		K         string   `json:"k"`
+		IndexBase int      `json:"index_base"`
+		Values    []string `json:"values"`
+		Default   float64  `json:"default"`
+		Delimiter string   `json:"delimiter"`
+	}
+)
+
+// The number of skipped rows that are logged one by one
+const CSV_REPORTED_ROWS = 10
+
+// True if the blocks are located by their indices rather than coordinates
+func (this *CsvParam) indexed() bool {
+	return len(this.I) > 0 || len(this.J) > 0 || len(this.K) > 0
+}
+
+func (this *CsvParam) check() error {
+
+	coords := []string{this.X, this.Y, this.Z}
+	if this.indexed() {
+		coords = []string{this.I, this.J, this.K}
+	}
+
+	for _, c := range coords {
+		if len(c) == 0 {
+			return fmt.Errorf("ERROR: csv input needs the x, y and z or the i, j and k column names")
+		}
+	}
+
+	if this.indexed() && (len(this.X) > 0 || len(this.Y) > 0 || len(this.Z) > 0) {
+		return fmt.Errorf("ERROR: csv input needs only one of the x, y and z and the i, j and k columns")
+	} else if len(this.Values) == 0 {
+		return fmt.Errorf("ERROR: csv input needs at least one values column")
+	} else if this.IndexBase != 0 && this.IndexBase != 1 {
+		return fmt.Errorf("ERROR: index_base must be 0 or 1. Supplied: %v", this.IndexBase)
+	} else if len([]rune(this.Delimiter)) > 1 {
+		return fmt.Errorf("ERROR: delimiter must be one character. Supplied: %v", this.Delimiter)
+	}
+
+	return nil
+}
+
+// The position of each name in the header
+func (this *CsvParam) columns(header []string) ([]int, error) {
+
+	names := []string{this.X, this.Y, this.Z}
+	if this.indexed() {
+		names = []string{this.I, this.J, this.K}
+	}
+	names = append(names, this.Values...)
+
+	position := make(map[string]int)
+	for i, h := range header {
+		position[strings.TrimSpace(h)] = i
+	}
+
+	cols := make([]int, len(names))
+
+	for i, name := range names {
+		c, ok := position[name]
+		if !ok {
+			return nil, fmt.Errorf("ERROR: column %v is not in the header", name)
+		}
+		cols[i] = c
+	}
+
+	return cols, nil
+}
+
+// The block of a row, from its coordinates or indices
+func (this *CsvParam) block(grid *Grid, location [3]float64) (int, bool) {
+
+	var ix, iy, iz int
+
+	if this.indexed() {
+		for _, v := range location {
+			if v != math.Trunc(v) {
+				return 0, false
+			}
+		}
+		ix = int(location[0]) - this.IndexBase
+		iy = int(location[1]) - this.IndexBase
+		iz = int(location[2]) - this.IndexBase
+	} else {
+		ix = int(math.Floor((location[0] - grid.MinX) / grid.SizX))
+		iy = int(math.Floor((location[1] - grid.MinY) / grid.SizY))
+		iz = int(math.Floor((location[2] - grid.MinZ) / grid.SizZ))
+	}
+
+	if ix < 0 || ix >= grid.NumX || iy < 0 || iy >= grid.NumY || iz < 0 || iz >= grid.NumZ {
+		return 0, false
+	}
+
+	k := grid.gridIndex(ix, iy, iz)
+
+	if !this.indexed() && !grid.gridPointInCell(k, location[0], location[1], location[2]) {
+		return 0, false
+	}
+
+	return k, true
+}
+
+// Read a CSV file, plain or gzipped, into the grid. Rows outside the grid
+// and repeated blocks are skipped and reported, the first row of a block is
+// kept.
+func (this *Data) initializeFromCsv(infile string) error {
+
+	param := &this.Csv
+
+	if e := param.check(); e != nil {
+		log.Error(e)
+		return &ParameterError{e}
+	}
+
+	f, e := os.Open(infile)
+
+	if e != nil {
+		log.Errorf("Error: failed initializing data from input file %v: %v", infile, e)
+		return e
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(infile, ".gz") {
+		zr, e := gzip.NewReader(f)
+		if e != nil {
+			log.Errorf("Error: failed initializing data from input file %v: %v", infile, e)
+			return e
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	if len(param.Delimiter) > 0 {
+		reader.Comma = []rune(param.Delimiter)[0]
+	}
+
+	//-------------------------------
+
+	header, e := reader.Read()
+
+	if e != nil {
+		e = fmt.Errorf("Error: failed reading header of input file %v: %v", infile, e)
+		log.Error(e)
+		return e
+	}
+
+	cols, e := param.columns(header)
+
+	if e != nil {
+		log.Error(e)
+		return &ParameterError{e}
+	}
+
+	// The grid gives the centroid of the first block, as for GSLIB
+	this.Grid.adjust4gslib()
+
+	//-------------------------------
+
+	cnt := this.Grid.gridCount()
+	nReal := len(param.Values)
+
+	this.Ebv = make([][]float64, nReal)
+	for i := range this.Ebv {
+		this.Ebv[i] = make([]float64, cnt)
+		for k := range this.Ebv[i] {
+			this.Ebv[i][k] = param.Default
+		}
+	}
+
+	seen := make([]bool, cnt)
+	var rows, outside, duplicate int
+
+	report := func(line int, reason string) {
+		if outside+duplicate <= CSV_REPORTED_ROWS {
+			log.Warnf("Skipping line %v of input file %v: %v", line, infile, reason)
+		}
+	}
+
+	for {
+
+		record, e := reader.Read()
+
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			e = fmt.Errorf("ERROR: input file %v: %v", infile, e)
+			log.Error(e)
+			return e
+		}
+
+		rows++
+		line, _ := reader.FieldPos(0)
+
+		values := make([]float64, len(cols))
+
+		for i, c := range cols {
+
+			values[i], e = strconv.ParseFloat(strings.TrimSpace(record[c]), 64)
+
+			if e != nil {
+				e = fmt.Errorf("ERROR: line %v of input file %v: %v", line, infile, e)
+				log.Error(e)
+				return e
+			}
+		}
+
+		k, ok := param.block(&this.Grid, [3]float64{values[0], values[1], values[2]})
+
+		if !ok {
+			outside++
+			report(line, "outside the grid")
+			continue
+		} else if seen[k] {
+			duplicate++
+			report(line, fmt.Sprintf("block %v, %v, %v repeated", this.Grid.gridIx(k), this.Grid.gridIy(k), this.Grid.gridIz(k)))
+			continue
+		}
+
+		seen[k] = true
+
+		for r := 0; r < nReal; r++ {
+			this.Ebv[r][k] = values[3+r]
+		}
+	}
+
+	//-------------------------------
+
+	blocks := rows - outside - duplicate
+
+	if blocks == 0 {
+		e = fmt.Errorf("ERROR: no blocks of input file %v are in the grid", infile)
+		log.Error(e)
+		return e
+	}
+
+	log.Infof("Read %v rows of %v realizations. Blocks: %v, missing: %v", rows, nReal, blocks, cnt-blocks)
+
+	if outside > 0 || duplicate > 0 {
+		log.Warnf("Skipped %v rows outside the grid and %v repeated blocks", outside, duplicate)
+	}
+
+	return nil
+}
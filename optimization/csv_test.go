@@ -0,0 +1,97 @@
+package optimization
+
+import (
+	"testing"
+)
+
+// The grid gives the centroid of the first block, so the blocks span 0 to
+// 20 in x and y
+var csvGrid = Grid{NumX: 2, NumY: 2, NumZ: 1, MinX: 5, MinY: 5, MinZ: 5, SizX: 10, SizY: 10, SizZ: 10}
+
+// Blocks are found by coordinates, rows outside the grid or repeated are
+// skipped and blocks not in the file take the default
+func TestCsvCoordinates(t *testing.T) {
+
+	text := "east,north,elev,a,b\n" +
+		"# comment\n" +
+		"15,5,5,1,2\n" +
+		"5,15,5,3,4\n" +
+		"25,5,5,9,9\n" +
+		"14,6,4,9,9\n"
+
+	data := &Data{
+		Type: Input_CSV,
+		Grid: csvGrid,
+		Csv:  CsvParam{X: "east", Y: "north", Z: "elev", Values: []string{"a", "b"}, Default: -1},
+	}
+
+	if e := data.initialize(writeTestFile(t, "model.csv", text)); e != nil {
+		t.Fatal(e)
+	}
+
+	want := [][]float64{{-1, 1, 3, -1}, {-1, 2, 4, -1}}
+
+	for r := range want {
+		for i, v := range want[r] {
+			if data.Ebv[r][i] != v {
+				t.Errorf("realization %v is %v, want %v", r, data.Ebv[r], want[r])
+				break
+			}
+		}
+	}
+
+	if g := data.Grid; g.MinX != 0 || g.MinY != 0 || g.MinZ != 0 {
+		t.Errorf("origin is %v %v %v, want the corner 0 0 0", g.MinX, g.MinY, g.MinZ)
+	}
+}
+
+// Blocks are found by indices counted from the base, gzipped with another
+// delimiter
+func TestCsvIndices(t *testing.T) {
+
+	text := "i;j;k;ebv\n2;2;1;7\n1;1;1;5\n0;1;1;9\n1.5;1;1;9\n"
+
+	data := &Data{
+		Type: Input_CSV,
+		Grid: csvGrid,
+		Csv:  CsvParam{I: "i", J: "j", K: "k", IndexBase: 1, Values: []string{"ebv"}, Delimiter: ";"},
+	}
+
+	if e := data.initialize(writeTestGzip(t, "model.csv.gz", text)); e != nil {
+		t.Fatal(e)
+	}
+
+	want := []float64{5, 0, 0, 7}
+
+	for i, v := range want {
+		if data.Ebv[0][i] != v {
+			t.Fatalf("read %v, want %v", data.Ebv[0], want)
+		}
+	}
+}
+
+func TestCsvErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		csv  CsvParam
+		text string
+	}{
+		{"no location", CsvParam{X: "x", Y: "y", Values: []string{"v"}}, "x,y,v\n1,1,1\n"},
+		{"both", CsvParam{X: "x", Y: "y", Z: "z", I: "i", J: "j", K: "k", Values: []string{"v"}}, "x,y,z,v\n1,1,1,1\n"},
+		{"no values", CsvParam{X: "x", Y: "y", Z: "z"}, "x,y,z\n1,1,1\n"},
+		{"base", CsvParam{I: "i", J: "j", K: "k", IndexBase: 2, Values: []string{"v"}}, "i,j,k,v\n2,2,2,1\n"},
+		{"header", CsvParam{X: "x", Y: "y", Z: "z", Values: []string{"w"}}, "x,y,z,v\n1,1,1,1\n"},
+		{"value", CsvParam{X: "x", Y: "y", Z: "z", Values: []string{"v"}}, "x,y,z,v\n1,1,1,x\n"},
+		{"outside", CsvParam{X: "x", Y: "y", Z: "z", Values: []string{"v"}}, "x,y,z,v\n99,1,1,1\n"},
+	}
+
+	for _, test := range tests {
+
+		data := &Data{Type: Input_CSV, Grid: csvGrid, Csv: test.csv}
+
+		if e := data.initialize(writeTestFile(t, "model.csv", test.text)); e == nil {
+			t.Errorf("%v: read %v, want an error", test.name, data.Ebv)
+		}
+	}
+}
@@ -4,20 +4,242 @@ import (
 	"bufio"
 	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 
 	log "github.com/cihub/seelog"
 )
 
+const (
+	Input_GSLIB = iota + 1
+	Input_GZIP
+	Input_CSV
+)
+
 type (
 	Data struct {
+		Type    int `json:"type"`
 		Grid    `json:"grid"`
 		EbvCols int         `json:"ebv_column"`
+		Csv     CsvParam    `json:"csv"`
 		Ebv     [][]float64 `json:"-"`
+		Tonnes  [][]float64 `json:"-"` // From the economics, if any
+		Ore     [][]bool    `json:"-"` // Processed rather than dumped, from the economics
+		// The elevation of each column, x fastest, if there is a topography
+		Topography []float64 `json:"-"`
 	}
 )
 
+// The first of the blocks at the end of the grid worth nothing in every
+// realization, the air above the model that the mask leaves out
+func (this *Data) airFrom() int {
+
+	n := this.Grid.gridCount()
+
+	for i := n - 1; i > 0; i-- {
+		// If one layer's value is not zero, the position is not empty
+		for _, layer := range this.Ebv {
+			if len(layer) > i && layer[i] != 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return 1
+}
+
+func (this *Data) initialize(infile string) error {
+	switch this.Type {
+	case Input_GSLIB:
+		return inputError(this.initializeFromGslib(infile))
+	case Input_GZIP:
+		return inputError(this.initializeFromGzip(infile))
+	case Input_CSV:
+		return inputError(this.initializeFromCsv(infile))
+	default:
+		e := fmt.Errorf("ERROR: invalid input type: %v", this.Type)
+		log.Error(e)
+		return &ParameterError{e}
+	}
+}
+
+// Read a GEOEAS (GSLIB) file with the EBV in the 1 indexed EbvCols column
+func (this *Data) initializeFromGslib(infile string) error {
+
+	columns, e := this.readGslib(infile, []int{this.EbvCols})
+
+	if e != nil {
+		return e
+	}
+
+	this.Ebv = columns[0]
+
+	return nil
+}
+
+// Read a GEOEAS (GSLIB) file, plain or gzipped. The header is a title line,
+// the number of columns and then one line per column name. Every following
+// line is a block, in the same order as the grid, and multiple realizations
+// follow one another. Returns each of the 1 indexed cols by realization.
+func (this *Data) readGslib(infile string, cols []int) ([][][]float64, error) {
+
+	f, e := os.Open(infile)
+
+	if e != nil {
+		log.Errorf("Error: failed initializing data from input file %v: %v", infile, e)
+		return nil, e
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(infile, ".gz") {
+		zr, e := gzip.NewReader(f)
+		if e != nil {
+			log.Errorf("Error: failed initializing data from input file %v: %v", infile, e)
+			return nil, e
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanLines)
+
+	//-------------------------------
+
+	ncol, names, e := readGslibHeader(s)
+
+	if e != nil {
+		e = fmt.Errorf("Error: failed reading header of input file %v: %v", infile, e)
+		log.Error(e)
+		return nil, e
+	}
+
+	for _, c := range cols {
+		if c < 1 || c > ncol {
+			e = fmt.Errorf("ERROR: columns must be between 1 and %v. Supplied: %v", ncol, c)
+			log.Error(e)
+			return nil, &ParameterError{e}
+		}
+		log.Infof("Reading column %v (%v)", c, names[c-1])
+	}
+
+	this.Grid.adjust4gslib()
+
+	//-------------------------------
+
+	cnt := this.Grid.gridCount()
+	columns := make([][][]float64, len(cols))
+	idx := 0
+	line := ncol + 2
+
+	faces := make([][]float64, len(cols))
+	for i := range faces {
+		faces[i] = make([]float64, cnt)
+	}
+
+	for s.Scan() {
+
+		line++
+
+		fields := strings.Fields(s.Text())
+
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) != ncol {
+			e = fmt.Errorf(
+				"ERROR: line %v of input file %v has %v columns, the header declares %v",
+				line, infile, len(fields), ncol,
+			)
+			log.Error(e)
+			return nil, e
+		}
+
+		for i, c := range cols {
+
+			v, e := strconv.ParseFloat(fields[c-1], 64)
+
+			if e != nil {
+				e = fmt.Errorf("ERROR: line %v of input file %v: %v", line, infile, e)
+				log.Error(e)
+				return nil, e
+			}
+
+			faces[i][idx] = v
+		}
+
+		// one layer has been read,begin next layer
+		if idx++; idx >= cnt {
+			for i, face := range faces {
+				layer := make([]float64, cnt)
+				copy(layer, face)
+				columns[i] = append(columns[i], layer)
+			}
+			idx = 0
+		}
+	}
+
+	//-------------------------------
+
+	if e = s.Err(); e != nil {
+		e = fmt.Errorf("Error: failed initializing data from input file %v: %v", infile, e)
+	} else if idx != 0 {
+		e = fmt.Errorf(
+			"Error: failed initializing data from input file %v: %v blocks left over, grid has %v blocks",
+			infile, idx, cnt,
+		)
+	} else if len(columns) > 0 && len(columns[0]) == 0 {
+		e = fmt.Errorf("ERROR: no data")
+	}
+
+	if e != nil {
+		log.Error(e)
+		return nil, e
+	}
+
+	return columns, nil
+}
+
+// Read the title, the number of columns and the column names
+func readGslibHeader(s *bufio.Scanner) (int, []string, error) {
+
+	if !s.Scan() {
+		return 0, nil, fmt.Errorf("missing title")
+	}
+
+	if !s.Scan() {
+		return 0, nil, fmt.Errorf("missing number of columns")
+	}
+
+	fields := strings.Fields(s.Text())
+
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("missing number of columns")
+	}
+
+	ncol, e := strconv.Atoi(fields[0])
+
+	if e != nil {
+		return 0, nil, fmt.Errorf("invalid number of columns: %v", e)
+	} else if ncol < 1 {
+		return 0, nil, fmt.Errorf("invalid number of columns: %v", ncol)
+	}
+
+	names := make([]string, ncol)
+
+	for i := range names {
+		if !s.Scan() {
+			return 0, nil, fmt.Errorf("expected %v column names, found %v", ncol, i)
+		}
+		names[i] = strings.TrimSpace(s.Text())
+	}
+
+	return ncol, names, nil
+}
+
 func (this *Data) initializeFromGzip(infile string) error {
 
 	f, e := os.Open(infile)
@@ -0,0 +1,133 @@
+package optimization
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write the text to a file of the name in a new directory
+func writeTestFile(t *testing.T, name, text string) string {
+
+	path := filepath.Join(t.TempDir(), name)
+
+	if e := os.WriteFile(path, []byte(text), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	return path
+}
+
+// Write the text gzipped to a file of the name in a new directory
+func writeTestGzip(t *testing.T, name, text string) string {
+
+	path := filepath.Join(t.TempDir(), name)
+
+	f, e := os.Create(path)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(text))
+
+	if e := zw.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	if e := f.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	return path
+}
+
+// Two realizations of a 2 by 1 by 1 grid, the EBV in the second column. The
+// grid gives the centroid of the first block, which moves to its corner.
+func TestGslibInput(t *testing.T) {
+
+	text := "model\n2\ngrade\nebv\n0.5 1.5\n0.2 -2\n0.7 3\n0.1 -4\n"
+
+	data := &Data{
+		Type:    Input_GSLIB,
+		Grid:    Grid{NumX: 2, NumY: 1, NumZ: 1, MinX: 5, MinY: 10, MinZ: 2.5, SizX: 10, SizY: 20, SizZ: 5},
+		EbvCols: 2,
+	}
+
+	if e := data.initialize(writeTestGzip(t, "model.txt.gz", text)); e != nil {
+		t.Fatal(e)
+	}
+
+	want := [][]float64{{1.5, -2}, {3, -4}}
+
+	if len(data.Ebv) != len(want) {
+		t.Fatalf("read %v realizations, want %v", len(data.Ebv), len(want))
+	}
+
+	for r := range want {
+		for i, v := range want[r] {
+			if data.Ebv[r][i] != v {
+				t.Errorf("realization %v is %v, want %v", r, data.Ebv[r], want[r])
+				break
+			}
+		}
+	}
+
+	if g := data.Grid; g.MinX != 0 || g.MinY != 0 || g.MinZ != 0 {
+		t.Errorf("origin is %v %v %v, want the corner 0 0 0", g.MinX, g.MinY, g.MinZ)
+	}
+
+	if c := data.Grid.blockCentroid(1, 0, 0); c != [3]float64{15, 10, 2.5} {
+		t.Errorf("second centroid is %v, want [15 10 2.5]", c)
+	}
+}
+
+// Files that do not agree with the grid or the EBV column are rejected
+func TestGslibInputErrors(t *testing.T) {
+
+	grid := Grid{NumX: 2, NumY: 1, NumZ: 1, SizX: 1, SizY: 1, SizZ: 1}
+
+	tests := []struct {
+		name string
+		text string
+		col  int
+	}{
+		{"column", "model\n1\nebv\n1\n2\n", 2},
+		{"fields", "model\n2\na\nb\n1 2\n3\n", 1},
+		{"left over", "model\n1\nebv\n1\n2\n3\n", 1},
+		{"no data", "model\n1\nebv\n", 1},
+		{"value", "model\n1\nebv\n1\nx\n", 1},
+	}
+
+	for _, test := range tests {
+
+		data := &Data{Type: Input_GSLIB, Grid: grid, EbvCols: test.col}
+
+		if e := data.initialize(writeTestFile(t, "model.txt", test.text)); e == nil {
+			t.Errorf("%v: read %v, want an error", test.name, data.Ebv)
+		}
+	}
+}
+
+// A gzip file is one EBV per line with no header, its grid gives the corner
+func TestGzipInput(t *testing.T) {
+
+	data := &Data{
+		Type: Input_GZIP,
+		Grid: Grid{NumX: 1, NumY: 1, NumZ: 2, MinX: 800, MinY: 100, MinZ: 50, SizX: 10, SizY: 10, SizZ: 10},
+	}
+
+	if e := data.initialize(writeTestGzip(t, "model.gz", "1\n-2\n3\n-4\n")); e != nil {
+		t.Fatal(e)
+	}
+
+	if len(data.Ebv) != 2 || data.Ebv[1][0] != 3 || data.Ebv[1][1] != -4 {
+		t.Errorf("read %v, want [[1 -2] [3 -4]]", data.Ebv)
+	}
+
+	if g := data.Grid; g.MinX != 800 || g.MinY != 100 || g.MinZ != 50 {
+		t.Errorf("origin moved to %v %v %v", g.MinX, g.MinY, g.MinZ)
+	}
+}
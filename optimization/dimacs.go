@@ -2,12 +2,15 @@ package optimization
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"math"
 	"os/exec"
 	"strconv"
 	"strings"
+
+	log "github.com/cihub/seelog"
 )
 
 type (
@@ -17,6 +20,7 @@ type (
 		cmd            *exec.Cmd
 		stdin          io.WriteCloser
 		stdout         io.ReadCloser
+		progress       *progress
 	}
 )
 
@@ -27,13 +31,15 @@ func newDimacsEngine(param *EngineParam) (UltpitEngine, error) {
 		precision:      param.Precision,
 	}
 
-	if math.Abs(engine.precision) < 1e6 {
-		engine.precision = 100.0
+	if engine.precision <= 0 {
+		engine.precision = DEFAULT_PRECISION
 	}
 
 	if e := engine.init(); e == nil {
 		return engine, nil
 	} else {
+		e = fmt.Errorf("ERROR: failed starting dimacs program %v: %v", engine.dimacs_program, e)
+		log.Error(e)
 		return nil, e
 	}
 }
@@ -55,13 +61,39 @@ func (this *DimacsSolver) init() error {
 	}
 }
 
-func (this *DimacsSolver) computeSolution(data []float64, pre *Precedence) (solution []bool, r int) {
+func (this *DimacsSolver) setProgress(p *progress) {
+	this.progress = p
+}
+
+func (this *DimacsSolver) computeSolution(ctx context.Context, data []float64, pre *Precedence) ([]bool, error) {
 
 	count := len(data)
 
-	solution = make([]bool, count)
+	solution := make([]bool, count)
+
+	stop := this.progress.waiting("running the dimacs program")
+	defer stop()
+
+	// Kill the program if the context ends first
+	finished := make(chan struct{})
+	defer close(finished)
 
-	this.sendInput(data, pre, this.stdin)
+	go func() {
+		select {
+		case <-ctx.Done():
+			this.cmd.Process.Kill()
+		case <-finished:
+		}
+	}()
+
+	// The writer keeps the first error, so a program that dies early shows up on flush
+	w := bufio.NewWriter(this.stdin)
+
+	e := this.sendInput(ctx, data, pre, w)
+
+	if e == nil {
+		e = w.Flush()
+	}
 	this.stdin.Close()
 
 	scanner := bufio.NewScanner(this.stdout)
@@ -70,18 +102,32 @@ func (this *DimacsSolver) computeSolution(data []float64, pre *Precedence) (solu
 	for scanner.Scan() {
 		items := strings.Fields(scanner.Text())
 		if len(items) == 2 && items[0] == "n" {
-			if n, e := strconv.Atoi(items[1]); e == nil && n != 1 {
+			if n, e := strconv.Atoi(items[1]); e == nil && n > 1 && n < count+2 {
 				solution[n-2] = true
 			}
 		}
 	}
 
-	this.cmd.Wait()
+	if e == nil {
+		e = scanner.Err()
+	}
+
+	if we := this.cmd.Wait(); e == nil {
+		e = we
+	}
 
-	return
+	if ce := ctx.Err(); ce != nil {
+		return nil, ce
+	} else if e != nil {
+		e = fmt.Errorf("ERROR: dimacs program %v failed: %v", this.dimacs_program, e)
+		log.Error(e)
+		return nil, e
+	}
+
+	return solution, nil
 }
 
-func (this *DimacsSolver) sendInput(data []float64, pre *Precedence, st io.Writer) {
+func (this *DimacsSolver) sendInput(ctx context.Context, data []float64, pre *Precedence, st io.Writer) error {
 
 	// source and sink
 	numNodes := len(data) + 2
@@ -121,6 +167,11 @@ func (this *DimacsSolver) sendInput(data []float64, pre *Precedence, st io.Write
 
 	// Now the infinite ones
 	for i := 0; i < len(data); i++ {
+		if (i+1)%CANCEL_CHECK == 0 {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+		}
 		from_i = i + 2 // + 1 for psuedo, +1 for source
 		if ind := pre.keys[i]; ind != MISSING {
 			for _, off := range pre.defs[ind] {
@@ -128,4 +179,6 @@ func (this *DimacsSolver) sendInput(data []float64, pre *Precedence, st io.Write
 			}
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,216 @@
+package optimization
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// Discount the value of each block by the time it is mined at, the
+	// Rate a year. The time is first the depth of the bottom of the block
+	// below the top of its column over the AdvanceRate, the metres a year
+	// the pit deepens. For each of the Iterations the pit is then
+	// scheduled, taking the periods as years, and solved again with the
+	// period each block is mined in; blocks not mined in any are taken a
+	// period after the last. The pits keep their undiscounted value, the
+	// discounted value beside it.
+	DiscountParam struct {
+		Rate        float64 `json:"rate"`
+		AdvanceRate float64 `json:"advance_rate"`
+		Iterations  int     `json:"iterations"`
+	}
+)
+
+// True if a discount was requested
+func (this *DiscountParam) enabled() bool {
+	return this.Rate > 0
+}
+
+func (this *DiscountParam) check() error {
+	if this.Rate < 0 {
+		return fmt.Errorf("ERROR: discount rate must not be negative. Supplied: %v", this.Rate)
+	} else if this.AdvanceRate <= 0 {
+		return fmt.Errorf("ERROR: advance rate must be positive. Supplied: %v", this.AdvanceRate)
+	} else if this.Iterations < 0 {
+		return fmt.Errorf("ERROR: discount iterations must not be negative. Supplied: %v", this.Iterations)
+	}
+	return nil
+}
+
+// The values of each realization discounted by the times of the blocks
+func (this *DiscountParam) apply(ebv [][]float64, times [][]float64) [][]float64 {
+
+	discounted := make([][]float64, len(ebv))
+
+	for r, layer := range ebv {
+		discounted[r] = make([]float64, len(layer))
+		for i, v := range layer {
+			discounted[r][i] = v * math.Pow(1+this.Rate, -times[r][i])
+		}
+	}
+
+	return discounted
+}
+
+// Solve the pits with the discounted values, then again with the times of
+// their schedules for each iteration
+func (ctx *Parameters) optimizingDiscounted(cx context.Context) (*Result, error) {
+
+	dp := &ctx.Discount
+
+	e := dp.check()
+
+	if e == nil && dp.Iterations > 0 && !ctx.Schedule.enabled() {
+		e = fmt.Errorf("ERROR: discount iterations need a schedule, supply a capacity")
+	}
+
+	if e != nil {
+		log.Error(e)
+		return nil, &ParameterError{e}
+	}
+
+	original := ctx.Input.Ebv
+	defer func() { ctx.Input.Ebv = original }()
+
+	times := ctx.depthTimes()
+
+	for it := 0; ; it++ {
+
+		if it == 0 {
+			log.Infof("Discounting at %v a year, deepening %v a year", dp.Rate, dp.AdvanceRate)
+		} else {
+			log.Infof("Discount iteration %v, mining times from the schedule", it)
+		}
+
+		discounted := dp.apply(original, times)
+
+		ctx.Input.Ebv = discounted
+		result, e := ctx.optimizingUndiscounted(cx)
+		ctx.Input.Ebv = original
+
+		if e != nil {
+			return nil, e
+		}
+
+		ctx.revalue(result, discounted)
+
+		if it >= dp.Iterations {
+			return result, nil
+		}
+
+		periods, e := ctx.scheduling(cx, pitRows(result))
+
+		if e != nil {
+			return nil, e
+		}
+
+		times = scheduleTimes(periods, len(original))
+	}
+}
+
+// The time each block is mined at from its depth below the top of its
+// column, the top of the highest block that is not air: above the
+// topography, or at the end of the grid as the mask takes it. The times are
+// the same for every realization.
+func (ctx *Parameters) depthTimes() [][]float64 {
+
+	g := &ctx.Input.Grid
+	columns := g.NumX * g.NumY
+	times := make([]float64, g.gridCount())
+
+	above := ctx.Input.air()
+	from := ctx.Input.airFrom()
+
+	air := func(i int) bool {
+		return (above != nil && above[i]) || i >= from
+	}
+
+	for c := 0; c < columns; c++ {
+
+		top := 0
+		for iz := g.NumZ - 1; iz >= 0; iz-- {
+			if !air(c + iz*columns) {
+				top = iz + 1
+				break
+			}
+		}
+
+		for iz := 0; iz < top; iz++ {
+			times[c+iz*columns] = float64(top-iz) * g.SizZ / ctx.Discount.AdvanceRate
+		}
+	}
+
+	rows := make([][]float64, len(ctx.Input.Ebv))
+	for r := range rows {
+		rows[r] = times
+	}
+
+	return rows
+}
+
+// The period each block is mined in as its time, a period after the last
+// for the blocks not mined. A single schedule gives the times of every
+// realization.
+func scheduleTimes(periods [][]int, nReal int) [][]float64 {
+
+	times := make([][]float64, nReal)
+
+	for r := range times {
+
+		row := periods[0]
+		if r < len(periods) {
+			row = periods[r]
+		}
+
+		last := 0
+		for _, t := range row {
+			if t > last {
+				last = t
+			}
+		}
+
+		times[r] = make([]float64, len(row))
+		for i, t := range row {
+			if t == 0 {
+				t = last + 1
+			}
+			times[r][i] = float64(t)
+		}
+	}
+
+	return times
+}
+
+// Give the pits solved with the discounted values their undiscounted value,
+// keeping the discounted beside it, and log both
+func (ctx *Parameters) revalue(result *Result, discounted [][]float64) {
+
+	if result.Values != nil {
+
+		pit := &result.Pits[0]
+		values := make([]float64, len(discounted))
+
+		for r := range discounted {
+			result.Values[r] = newPit(pit.Selected, ctx.Input.Ebv[r]).Value
+			values[r] = newPit(pit.Selected, discounted[r]).Value
+		}
+
+		pit.Value = mean(result.Values)
+		pit.Discounted = mean(values)
+
+		log.Infof("Single pit. Blocks: %-6v, EBV: %f, discounted: %f", pit.Blocks, pit.Value, pit.Discounted)
+		return
+	}
+
+	for r := range result.Pits {
+
+		pit := &result.Pits[r]
+		pit.Value = newPit(pit.Selected, ctx.Input.Ebv[r]).Value
+		pit.Discounted = newPit(pit.Selected, discounted[r]).Value
+
+		log.Infof("Realization %3v. Blocks: %-6v, EBV: %f, discounted: %f", r, pit.Blocks, pit.Value, pit.Discounted)
+	}
+}
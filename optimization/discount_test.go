@@ -0,0 +1,95 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+)
+
+// The time is the depth of the bottom of each block below the top of its
+// column over the advance rate
+func TestDepthTimes(t *testing.T) {
+
+	ctx := &Parameters{
+		Input: Data{
+			Grid: Grid{NumX: 2, NumY: 1, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10},
+			// The first column has air on top
+			Ebv:        [][]float64{{-1, 5, 2, -1, 0, -3}, {-1, 5, 2, 1, 0, -3}},
+			Topography: []float64{20, 30},
+		},
+		Discount: DiscountParam{Rate: 0.1, AdvanceRate: 5},
+	}
+
+	want := []float64{4, 6, 2, 4, 0, 2}
+	times := ctx.depthTimes()
+
+	if len(times) != 2 {
+		t.Fatalf("times for %v realizations, want 2", len(times))
+	}
+
+	for r := range times {
+		for i := range want {
+			if times[r][i] != want[i] {
+				t.Errorf("realization %v: times %v, want %v", r, times[r], want)
+				break
+			}
+		}
+	}
+
+	// Without the topography a block worth nothing is waste to dig through
+	ctx.Input.Topography = nil
+	want = []float64{6, 6, 4, 4, 2, 2}
+	times = ctx.depthTimes()
+
+	for i := range want {
+		if times[0][i] != want[i] {
+			t.Errorf("no topography: times %v, want %v", times[0], want)
+			break
+		}
+	}
+}
+
+// Blocks that are not mined come a period after the last, one schedule
+// serving every realization
+func TestScheduleTimes(t *testing.T) {
+
+	times := scheduleTimes([][]int{{1, 0, 2, 2}}, 2)
+	want := []float64{1, 3, 2, 2}
+
+	if len(times) != 2 {
+		t.Fatalf("times for %v realizations, want 2", len(times))
+	}
+
+	for r := range times {
+		for i := range want {
+			if times[r][i] != want[i] {
+				t.Errorf("realization %v: times %v, want %v", r, times[r], want)
+				break
+			}
+		}
+	}
+
+	times = scheduleTimes([][]int{{1, 0}, {0, 0}}, 2)
+
+	if times[0][1] != 2 || times[1][0] != 1 {
+		t.Errorf("times %v, want [[1 2] [1 1]]", times)
+	}
+}
+
+func TestDiscountApply(t *testing.T) {
+
+	dp := &DiscountParam{Rate: 0.1, AdvanceRate: 1}
+	got := dp.apply([][]float64{{121, -110, 5}}, [][]float64{{2, 1, 0}})
+	want := []float64{100, -100, 5}
+
+	for i := range want {
+		if math.Abs(got[0][i]-want[i]) > 1e-9 {
+			t.Fatalf("discounted %v, want %v", got[0], want)
+		}
+	}
+
+	for _, dp := range []DiscountParam{{Rate: -1, AdvanceRate: 1}, {Rate: 0.1}, {Rate: 0.1, AdvanceRate: 1, Iterations: -1}} {
+		if dp.check() == nil {
+			t.Errorf("%+v accepted", dp)
+		}
+	}
+}
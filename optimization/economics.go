@@ -0,0 +1,163 @@
+package optimization
+
+import (
+	"fmt"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// Calculates the EBVs from the block attributes of a GSLIB input. Each
+	// block is sent to the process or to the waste dump, whichever is worth
+	// more, so the cutoff is the marginal one.
+	Economics struct {
+		TonnageColumn  int          `json:"tonnage_column"`
+		DensityColumn  int          `json:"density_column"`
+		Density        float64      `json:"density"`
+		MiningCost     float64      `json:"mining_cost"`
+		ProcessingCost float64      `json:"processing_cost"`
+		Grades         []GradeParam `json:"grades"`
+	}
+
+	GradeParam struct {
+		Column      int     `json:"column"`
+		Price       float64 `json:"price"`
+		Recovery    float64 `json:"recovery"`
+		SellingCost float64 `json:"selling_cost"`
+		Units       float64 `json:"units"`
+	}
+)
+
+// True if the EBVs should be calculated
+func (this *Economics) enabled() bool {
+	return len(this.Grades) > 0
+}
+
+func (this *Economics) validate() error {
+
+	if this.TonnageColumn > 0 && this.DensityColumn > 0 {
+		return fmt.Errorf("ERROR: supply only one of tonnage_column and density_column")
+	} else if this.TonnageColumn <= 0 && this.DensityColumn <= 0 && this.Density <= 0 {
+		return fmt.Errorf("ERROR: economics needs a tonnage_column, a density_column or a density")
+	} else if this.MiningCost < 0 || this.ProcessingCost < 0 {
+		return fmt.Errorf("ERROR: costs must not be negative")
+	}
+
+	for _, g := range this.Grades {
+		if g.Column < 1 {
+			return fmt.Errorf("ERROR: grade column must be 1 indexed. Supplied: %v", g.Column)
+		} else if g.Recovery < 0 || g.Recovery > 1 {
+			return fmt.Errorf("ERROR: recovery must be between 0 and 1. Supplied: %v", g.Recovery)
+		}
+	}
+
+	return nil
+}
+
+// The columns to read, tonnage or density first (if any) then the grades
+func (this *Economics) columns() []int {
+
+	var cols []int
+
+	if this.TonnageColumn > 0 {
+		cols = append(cols, this.TonnageColumn)
+	} else if this.DensityColumn > 0 {
+		cols = append(cols, this.DensityColumn)
+	}
+
+	for _, g := range this.Grades {
+		cols = append(cols, g.Column)
+	}
+
+	return cols
+}
+
+// Read the block attributes and replace the EBVs of the data
+func (this *Economics) initialize(data *Data, infile string) error {
+
+	var e error
+
+	if e = this.validate(); e == nil && data.Type != Input_GSLIB {
+		e = fmt.Errorf("ERROR: economics needs a GSLIB input, type %v", Input_GSLIB)
+	}
+
+	if e != nil {
+		log.Error(e)
+		return &ParameterError{e}
+	}
+
+	columns, e := data.readGslib(infile, this.columns())
+
+	if e != nil {
+		return inputError(e)
+	}
+
+	volume := data.Grid.SizX * data.Grid.SizY * data.Grid.SizZ
+	nReal := len(columns[0])
+	cnt := data.Grid.gridCount()
+
+	data.Ebv = make([][]float64, nReal)
+	data.Tonnes = make([][]float64, nReal)
+	data.Ore = make([][]bool, nReal)
+
+	var processed, wasted int64
+
+	for r := 0; r < nReal; r++ {
+
+		data.Ebv[r] = make([]float64, cnt)
+		data.Tonnes[r] = make([]float64, cnt)
+		data.Ore[r] = make([]bool, cnt)
+
+		for i := 0; i < cnt; i++ {
+
+			var tonnes float64
+			grades := columns
+
+			if this.TonnageColumn > 0 {
+				tonnes = columns[0][r][i]
+				grades = columns[1:]
+			} else if this.DensityColumn > 0 {
+				tonnes = columns[0][r][i] * volume
+				grades = columns[1:]
+			} else {
+				tonnes = this.Density * volume
+			}
+
+			if tonnes <= 0 {
+				// Air
+				continue
+			}
+
+			data.Tonnes[r][i] = tonnes
+
+			var revenue float64
+
+			for k, g := range this.Grades {
+
+				units := g.Units
+				if units <= 0 {
+					units = 1.0
+				}
+
+				metal := tonnes * grades[k][r][i] / units * g.Recovery
+				revenue += metal * (g.Price - g.SellingCost)
+			}
+
+			waste := -tonnes * this.MiningCost
+			process := revenue - tonnes*(this.MiningCost+this.ProcessingCost)
+
+			if process > waste {
+				data.Ebv[r][i] = process
+				data.Ore[r][i] = true
+				processed++
+			} else {
+				data.Ebv[r][i] = waste
+				wasted++
+			}
+		}
+	}
+
+	log.Infof("Calculated EBVs. Process: %v, Waste: %v", processed, wasted)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+)
+
+// Each block goes to the process or the dump, whichever is worth more, and
+// blocks of no density are air
+func TestEconomicsEbv(t *testing.T) {
+
+	text := "model\n2\ndensity\ngrade\n2.5 50\n2 0\n0 30\n"
+
+	data := &Data{
+		Type: Input_GSLIB,
+		Grid: Grid{NumX: 1, NumY: 1, NumZ: 3, SizX: 1, SizY: 1, SizZ: 1},
+	}
+
+	economics := &Economics{
+		DensityColumn:  1,
+		MiningCost:     2,
+		ProcessingCost: 10,
+		Grades:         []GradeParam{{Column: 2, Price: 100, Recovery: 0.9, SellingCost: 10, Units: 100}},
+	}
+
+	if e := economics.initialize(data, writeTestFile(t, "model.txt", text)); e != nil {
+		t.Fatal(e)
+	}
+
+	// 2.5 t at 50 % recovers 1.125 t of metal worth 90 a tonne, less the
+	// costs of 12 a tonne. 2 t of waste cost 2 a tonne to dump.
+	want := []float64{101.25 - 30, -4, 0}
+
+	for i, v := range want {
+		if math.Abs(data.Ebv[0][i]-v) > 1e-9 {
+			t.Fatalf("EBVs %v, want %v", data.Ebv[0], want)
+		}
+	}
+}
+
+func TestEconomicsValidate(t *testing.T) {
+
+	tests := []Economics{
+		{TonnageColumn: 1, DensityColumn: 2},
+		{},
+		{Density: 2.7, MiningCost: -1},
+		{Density: 2.7, Grades: []GradeParam{{Column: 0}}},
+		{Density: 2.7, Grades: []GradeParam{{Column: 1, Recovery: 1.5}}},
+	}
+
+	for _, economics := range tests {
+		if e := economics.validate(); e == nil {
+			t.Errorf("%+v accepted", economics)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package optimization
+
+import "context"
+
+type (
+	// The parameters are missing or invalid
+	ParameterError struct {
+		Err error
+	}
+
+	// The input could not be read, or does not agree with the parameters
+	InputError struct {
+		Err error
+	}
+
+	// The optimization engine could not be started
+	EngineError struct {
+		Err error
+	}
+
+	// The optimization engine failed, or gave no solution
+	SolverError struct {
+		Err error
+	}
+
+	// The results could not be written
+	OutputError struct {
+		Err error
+	}
+)
+
+func (this *ParameterError) Error() string { return this.Err.Error() }
+func (this *ParameterError) Unwrap() error { return this.Err }
+
+func (this *InputError) Error() string { return this.Err.Error() }
+func (this *InputError) Unwrap() error { return this.Err }
+
+func (this *EngineError) Error() string { return this.Err.Error() }
+func (this *EngineError) Unwrap() error { return this.Err }
+
+func (this *SolverError) Error() string { return this.Err.Error() }
+func (this *SolverError) Unwrap() error { return this.Err }
+
+func (this *OutputError) Error() string { return this.Err.Error() }
+func (this *OutputError) Unwrap() error { return this.Err }
+
+// Wrap the error as a parameter error, keeping nil and typed errors as is
+func parameterError(e error) error {
+	if e == nil || isTyped(e) {
+		return e
+	}
+	return &ParameterError{e}
+}
+
+func inputError(e error) error {
+	if e == nil || isTyped(e) {
+		return e
+	}
+	return &InputError{e}
+}
+
+func engineError(e error) error {
+	if e == nil || isTyped(e) {
+		return e
+	}
+	return &EngineError{e}
+}
+
+func solverError(e error) error {
+	if e == nil || isTyped(e) {
+		return e
+	}
+	return &SolverError{e}
+}
+
+func outputError(e error) error {
+	if e == nil || isTyped(e) {
+		return e
+	}
+	return &OutputError{e}
+}
+
+// True for the errors above, and for those of an ended context which are
+// returned as they are.
+func isTyped(e error) bool {
+	switch e.(type) {
+	case *ParameterError, *InputError, *EngineError, *SolverError, *OutputError:
+		return true
+	}
+	return e == context.Canceled || e == context.DeadlineExceeded
+}
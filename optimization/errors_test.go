@@ -0,0 +1,153 @@
+package optimization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Each kind of failure returns its own type of error
+func TestDoMiningOptimizationErrors(t *testing.T) {
+
+	input := writeTestGzip(t, "model.gz", "5\n-1\n")
+	output := filepath.Join(t.TempDir(), "pits.txt")
+
+	paramFile := func(inputType, method, engine int) string {
+		return writeTestFile(t, "params.json", fmt.Sprintf(`{
+			"input": {"type": %v, "grid": {"num_x": 1, "num_y": 1, "num_z": 2, "siz_x": 10, "siz_y": 10, "siz_z": 10}},
+			"precedence": {"method": %v, "slope": 45, "num_benches": 1},
+			"optimization": {"engine": %v}
+		}`, inputType, method, engine))
+	}
+
+	isParameter := func(e error) bool { var te *ParameterError; return errors.As(e, &te) }
+	isInput := func(e error) bool { var te *InputError; return errors.As(e, &te) }
+	isOutput := func(e error) bool { var te *OutputError; return errors.As(e, &te) }
+
+	tests := []struct {
+		name                  string
+		input, output, params string
+		check                 func(error) bool
+	}{
+		{"no parameters", input, output, filepath.Join(t.TempDir(), "none.json"), isParameter},
+		{"input type", input, output, paramFile(9, BENCH, 1), isParameter},
+		{"no input", filepath.Join(t.TempDir(), "none.gz"), output, paramFile(Input_GZIP, BENCH, 1), isInput},
+		{"method", input, output, paramFile(Input_GZIP, 9, 1), isParameter},
+		{"engine", input, output, paramFile(Input_GZIP, BENCH, 9), isParameter},
+		{"output", input, filepath.Join(output, "none", "pits.txt"), paramFile(Input_GZIP, BENCH, 1), isOutput},
+		{"valid", input, output, paramFile(Input_GZIP, BENCH, 1), func(e error) bool { return e == nil }},
+	}
+
+	for _, test := range tests {
+		opt := MiningOptParams{InputFile: test.input, OutputFile: test.output, ParamFile: test.params}
+		if e := DoMiningOptimization(opt); !test.check(e) {
+			t.Errorf("%v: got %v (%T)", test.name, e, e)
+		}
+	}
+}
+
+// A run whose context has ended returns its error and writes no output
+func TestCancelledRun(t *testing.T) {
+
+	output := filepath.Join(t.TempDir(), "pits.txt")
+
+	opt := MiningOptParams{
+		InputFile:  writeTestGzip(t, "model.gz", "5\n-1\n"),
+		OutputFile: output,
+		ParamFile: writeTestFile(t, "params.json", `{
+			"input": {"type": 2, "grid": {"num_x": 1, "num_y": 1, "num_z": 2, "siz_x": 10, "siz_y": 10, "siz_z": 10}},
+			"precedence": {"method": 1, "slope": 45, "num_benches": 1},
+			"optimization": {"engine": 1}
+		}`),
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	for _, test := range []struct {
+		ctx  context.Context
+		want error
+	}{
+		{cancelled, context.Canceled},
+		{expired, context.DeadlineExceeded},
+	} {
+
+		if e := DoMiningOptimizationContext(test.ctx, opt); !errors.Is(e, test.want) {
+			t.Errorf("got %v, want %v", e, test.want)
+		}
+
+		if _, e := os.Stat(output); !os.IsNotExist(e) {
+			t.Errorf("output written after %v", test.want)
+		}
+	}
+}
+
+// Output files are renamed into place together, or all removed
+func TestOutputFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "pits.txt"), filepath.Join(dir, "pit.asc.gz")}
+
+	write := func(files *outputFiles) {
+		for _, path := range paths {
+			e := files.write(context.Background(), path, func(w io.Writer) error {
+				_, e := io.WriteString(w, "1\n")
+				return e
+			})
+			if e != nil {
+				t.Fatal(e)
+			}
+		}
+	}
+
+	files := &outputFiles{}
+	write(files)
+	files.discard()
+
+	if left, _ := os.ReadDir(dir); len(left) != 0 {
+		t.Errorf("%v files left after discarding", len(left))
+	}
+
+	files = &outputFiles{}
+	write(files)
+
+	if e := files.commit(); e != nil {
+		t.Fatal(e)
+	}
+
+	for _, path := range paths {
+		if _, e := os.Stat(path); e != nil {
+			t.Error(e)
+		}
+	}
+
+	if left, _ := os.ReadDir(dir); len(left) != len(paths) {
+		t.Errorf("%v files after committing, want %v", len(left), len(paths))
+	}
+}
+
+// Typed errors are kept as they are, others are wrapped
+func TestErrorWrapping(t *testing.T) {
+
+	input := &InputError{fmt.Errorf("ERROR: input")}
+
+	if e := solverError(input); e != input {
+		t.Errorf("typed error wrapped as %T", e)
+	}
+
+	if e := solverError(nil); e != nil {
+		t.Errorf("nil wrapped as %v", e)
+	}
+
+	var solver *SolverError
+	if e := solverError(fmt.Errorf("ERROR: solver")); !errors.As(e, &solver) {
+		t.Errorf("got %T, want a SolverError", e)
+	}
+}
@@ -16,14 +16,24 @@ type (
 		SizY float64 `json:"siz_y"`
 		SizZ float64 `json:"siz_z"`
 
-		gridcnt int
+		gridcnt  int
+		adjusted bool // The origin was moved to the corner
 	}
 )
 
+// GSLIB grids give the centroid of the first block, move it to the corner.
+// Only the first call moves it, each read of the input calls it.
 func (this *Grid) adjust4gslib() {
-	this.MinX = this.SizX / 2.0
-	this.MinY = this.SizY / 2.0
-	this.MinZ = this.SizZ / 2.0
+
+	if this.adjusted {
+		return
+	}
+
+	this.adjusted = true
+
+	this.MinX -= this.SizX / 2.0
+	this.MinY -= this.SizY / 2.0
+	this.MinZ -= this.SizZ / 2.0
 }
 
 /**
@@ -97,6 +107,25 @@ func (this *Grid) String() string {
 	return retval
 }
 
+// The number of blocks
+func (this *Grid) Count() int {
+	return this.gridCount()
+}
+
+// The index of the block, x varies fastest then y then z (upwards)
+func (this *Grid) Index(ix, iy, iz int) int {
+	return this.gridIndex(ix, iy, iz)
+}
+
+func (this *Grid) validate() error {
+	if this.NumX <= 0 || this.NumY <= 0 || this.NumZ <= 0 {
+		return fmt.Errorf("ERROR: grid must have blocks in x, y and z. Supplied: %v, %v, %v", this.NumX, this.NumY, this.NumZ)
+	} else if this.SizX <= 0 || this.SizY <= 0 || this.SizZ <= 0 {
+		return fmt.Errorf("ERROR: block sizes must be positive. Supplied: %v, %v, %v", this.SizX, this.SizY, this.SizZ)
+	}
+	return nil
+}
+
 // The number of blocks
 func (this *Grid) gridCount() int {
 	if this.gridcnt <= 0 {
@@ -1,6 +1,7 @@
 package optimization
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -8,8 +9,13 @@ const (
 	Engine_LERCHSGROSSMANN = iota + 1
 	Engine_DIMACSPROGRAM
 	Engine_PSEUDOFLOW
+	Engine_MAXFLOW
 )
 
+// The default scaling applied to the EBVs before they become the integer
+// capacities of the DIMACS and pseudoflow engines
+const DEFAULT_PRECISION = 1e6
+
 const (
 	PLUS    = true
 	MINUS   = false
@@ -17,6 +23,8 @@ const (
 	WEAK    = false
 	ROOT    = -1
 	NOTHING = -1
+	// Iterations between checks of the context
+	CANCEL_CHECK = 1 << 12
 )
 
 type (
@@ -27,7 +35,8 @@ type (
 	}
 
 	UltpitEngine interface {
-		computeSolution(data []float64, pre *Precedence) ([]bool, int)
+		computeSolution(ctx context.Context, data []float64, pre *Precedence) ([]bool, error)
+		setProgress(p *progress)
 	}
 
 	LG_Vertex struct {
@@ -56,6 +65,8 @@ type (
 		arcsAdded        int64
 		countSinceChange int64
 		count            int
+		passes           int64
+		progress         *progress
 
 		strongPlusses *IntStack
 		strongMinuses *IntStack
@@ -67,15 +78,46 @@ func getEngine(param *EngineParam) (UltpitEngine, error) {
 	case Engine_LERCHSGROSSMANN:
 		return new(LG3D), nil
 	case Engine_DIMACSPROGRAM:
-		return newDimacsEngine(param)
+		engine, e := newDimacsEngine(param)
+		return engine, engineError(e)
 	case Engine_PSEUDOFLOW:
-		return newPseudoflowEngine(param)
+		engine, e := newPseudoflowEngine(param)
+		return engine, engineError(e)
+	case Engine_MAXFLOW:
+		engine, e := newMaxFlowEngine(param)
+		return engine, engineError(e)
 	default:
-		return nil, fmt.Errorf("Invalid engine type")
+		return nil, &ParameterError{fmt.Errorf("ERROR: invalid engine type: %v", param.EngineType)}
 	}
 }
 
-func (this *LG3D) computeSolution(data []float64, pre *Precedence) (solution []bool, n int) {
+// Roughly the bytes an engine needs for the blocks and precedence arcs
+func engineMemory(param *EngineParam, blocks int, arcs int64) int64 {
+
+	var perBlock, perArc int64
+
+	switch param.EngineType {
+	case Engine_LERCHSGROSSMANN:
+		// Vertex, root edge and tree edges, the arcs are shared
+		perBlock, perArc = 320, 0
+	case Engine_PSEUDOFLOW:
+		// The arcs and nodes handed to pseudo, and its own copy
+		perBlock, perArc = 160, 64
+	case Engine_MAXFLOW:
+		perBlock, perArc = 64, 12
+	default:
+		// The external program has its own memory
+		perBlock, perArc = 16, 0
+	}
+
+	return int64(blocks)*perBlock + arcs*perArc + 1
+}
+
+func (this *LG3D) setProgress(p *progress) {
+	this.progress = p
+}
+
+func (this *LG3D) computeSolution(ctx context.Context, data []float64, pre *Precedence) (solution []bool, e error) {
 
 	this.count = len(data)
 
@@ -83,7 +125,9 @@ func (this *LG3D) computeSolution(data []float64, pre *Precedence) (solution []b
 
 	this.initNormalizedTree(data, pre)
 
-	this.solve()
+	if e = this.solve(ctx); e != nil {
+		return nil, e
+	}
 
 	for i := 0; i < this.count; i++ {
 		solution[i] = this.V[i].strength
@@ -124,12 +168,21 @@ func (this *LG3D) initNormalizedTree(data []float64, pre *Precedence) {
 	}
 }
 
-func (this *LG3D) solve() {
+func (this *LG3D) solve(ctx context.Context) error {
 
-	var xk int
+	var xk, iter int
 
 	for this.countSinceChange++; this.countSinceChange <= int64(this.count); this.countSinceChange++ {
 
+		if iter++; iter%CANCEL_CHECK == 0 {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+			if this.progress.due() {
+				this.reportProgress()
+			}
+		}
+
 		if this.V[xk].strength {
 
 			if xi := this.checkPrecedence(xk); xi != -1 {
@@ -148,8 +201,32 @@ func (this *LG3D) solve() {
 
 		if xk++; xk >= this.count {
 			xk = 0
+			this.passes++
+		}
+	}
+
+	return nil
+}
+
+func (this *LG3D) reportProgress() {
+
+	p := Progress{
+		Stage:     "normalizing the tree",
+		Pass:      this.passes + 1,
+		ArcsAdded: this.arcsAdded,
+		Fraction:  -1,
+	}
+
+	for _, v := range this.V {
+		if v.strength {
+			p.Strong++
+			p.Value += v.mass
+		} else {
+			p.Weak++
 		}
 	}
+
+	this.progress.send(p)
 }
 
 func (this *LG3D) moveTowardFeasibility(xk, xi int) {
@@ -337,7 +414,6 @@ func (this *LG3D) swapStrongPlus(e int) {
 	V := this.V
 
 	source := E[e].source
-	target := E[e].target
 
 	thisMass := E[e].mass
 
@@ -367,16 +443,9 @@ func (this *LG3D) swapStrongPlus(e int) {
 
 	E[e].source = ROOT
 
-	baseEdge := V[last].rootEdge
-	baseMass := E[baseEdge].mass
-
-	if baseMass > 0 {
-		if !V[source].strength {
-			this.activateBranchToxk(e, -1)
-		}
-	} else if V[target].strength {
-		this.deactivateBranch(baseEdge)
-	}
+	// Both branches may have changed sign
+	this.setBranchStrength(V[last].rootEdge)
+	this.setBranchStrength(e)
 }
 
 func (this *LG3D) swapStrongMinus(e int) {
@@ -394,11 +463,13 @@ func (this *LG3D) swapStrongMinus(e int) {
 
 	thisMass := E[e].mass
 
-	var next int
+	var next, last int
 
 	current := target
 
 	for {
+		last = current
+
 		edge := V[current].rootEdge
 
 		if E[edge].direction {
@@ -414,9 +485,37 @@ func (this *LG3D) swapStrongMinus(e int) {
 		}
 	}
 
+	// The edge now hangs from the root, so its old parent must forget it
+	V[target].removeInEdge(e)
+
 	E[e].direction = PLUS
 	E[e].target = source
 	E[e].source = ROOT
+
+	// Both branches may have changed sign
+	this.setBranchStrength(V[last].rootEdge)
+	this.setBranchStrength(e)
+}
+
+// Make every vertex of the branch strong or weak according to its mass
+func (this *LG3D) setBranchStrength(base int) {
+
+	var nextV int
+
+	if this.E[base].direction {
+		nextV = this.E[base].target
+	} else {
+		nextV = this.E[base].source
+	}
+
+	// A branch shares one strength, so only walk it when that changes
+	if strong := this.E[base].mass > 0; strong == this.V[nextV].strength {
+		return
+	} else if strong {
+		this.activateBranchToxk(base, ROOT)
+	} else {
+		this.deactivateBranch(base)
+	}
 }
 
 //---------------------------------------------------------------------------
@@ -462,7 +561,6 @@ func (this *IntStack) pop() int {
 		return t
 	} else {
 		panic("Empty Stack.")
-		return -1
 	}
 }
 
@@ -471,7 +569,6 @@ func (this *IntStack) peek() int {
 		return this.items[l-1]
 	} else {
 		panic("Empty Stack.")
-		return -1
 	}
 }
 
@@ -0,0 +1,365 @@
+package optimization
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+type (
+	// Solves the maximum closure directly on the precedence with float64
+	// masses. Positive blocks are supplied by the source and negative blocks
+	// drain to the sink, the precedence arcs have infinite capacity. Dinic's
+	// blocking flows are used, the arcs are never built explicitly.
+	MaxFlowSolver struct {
+		count int
+		pre   *Precedence
+		eps   float64
+
+		supply []float64 // remaining capacity of the source arcs
+		demand []float64 // remaining capacity of the sink arcs
+
+		arcStart []int     // first arc of each block, arcs follow keys/defs
+		flow     []float64 // flow on each precedence arc
+		revStart []int     // first incoming arc of each block
+		revArcs  []int32   // incoming arcs grouped by target
+
+		level     []int32
+		sinkLevel int32
+		cur       []int32
+		queue     []int32
+
+		phases   int64
+		progress *progress
+	}
+)
+
+const (
+	MAXFLOW_UNSEEN = -1
+	// Relative to the total positive mass, anything below is zero
+	MAXFLOW_TOLERANCE = 1e-12
+)
+
+func newMaxFlowEngine(param *EngineParam) (UltpitEngine, error) {
+	return new(MaxFlowSolver), nil
+}
+
+func (this *MaxFlowSolver) setProgress(p *progress) {
+	this.progress = p
+}
+
+func (this *MaxFlowSolver) computeSolution(ctx context.Context, data []float64, pre *Precedence) (solution []bool, e error) {
+
+	this.initNetwork(data, pre)
+
+	for this.buildLevels() {
+		if this.phases++; this.progress.due() {
+			this.reportProgress()
+		}
+		if e = this.blockingFlow(ctx); e != nil {
+			return nil, e
+		}
+	}
+
+	// The pit is whatever can still be reached from the source
+	this.reachable()
+
+	solution = make([]bool, this.count)
+	for i := range solution {
+		solution[i] = this.level[i] != MAXFLOW_UNSEEN
+	}
+
+	return
+}
+
+func (this *MaxFlowSolver) initNetwork(data []float64, pre *Precedence) {
+
+	n := len(data)
+
+	this.count = n
+	this.pre = pre
+	this.supply = make([]float64, n)
+	this.demand = make([]float64, n)
+	this.arcStart = make([]int, n+1)
+	this.revStart = make([]int, n+1)
+
+	total := 0.0
+
+	for i, v := range data {
+		if v > 0 {
+			this.supply[i] = v
+			total += v
+		} else {
+			this.demand[i] = -v
+		}
+
+		this.arcStart[i+1] = this.arcStart[i]
+
+		if key := pre.keys[i]; key != MISSING {
+			this.arcStart[i+1] += len(pre.defs[key])
+			for _, off := range pre.defs[key] {
+				this.revStart[i+off+1]++
+			}
+		}
+	}
+
+	this.eps = total * MAXFLOW_TOLERANCE
+
+	for i := 0; i < n; i++ {
+		this.revStart[i+1] += this.revStart[i]
+	}
+
+	numArcs := this.arcStart[n]
+
+	this.flow = make([]float64, numArcs)
+	this.revArcs = make([]int32, numArcs)
+
+	fill := make([]int, n)
+	copy(fill, this.revStart[:n])
+
+	for i := 0; i < n; i++ {
+		if key := pre.keys[i]; key != MISSING {
+			for k, off := range pre.defs[key] {
+				this.revArcs[fill[i+off]] = int32(this.arcStart[i] + k)
+				fill[i+off]++
+			}
+		}
+	}
+
+	this.level = make([]int32, n)
+	this.cur = make([]int32, n)
+	this.queue = make([]int32, 0, n)
+}
+
+// Whatever supply is left bounds the value of the pit
+func (this *MaxFlowSolver) reportProgress() {
+
+	p := Progress{
+		Stage:    "blocking flows",
+		Pass:     this.phases,
+		Fraction: -1,
+	}
+
+	for _, s := range this.supply {
+		p.Value += s
+	}
+
+	this.progress.send(p)
+}
+
+// The block an arc leaves from
+func (this *MaxFlowSolver) arcSource(a int) int {
+	return sort.Search(this.count, func(i int) bool { return this.arcStart[i+1] > a })
+}
+
+func (this *MaxFlowSolver) outDegree(u int) int {
+	return this.arcStart[u+1] - this.arcStart[u]
+}
+
+// The next admissible arc out of u, starting from its current arc. Forward
+// arcs come first and always have room, reverse arcs need flow to cancel.
+// Returns the neighbour and the arc, or MAXFLOW_UNSEEN when there is none.
+func (this *MaxFlowSolver) advance(u int) (int, int) {
+
+	want := this.level[u] + 1
+	k := int(this.cur[u])
+	nf := this.outDegree(u)
+
+	if k < nf {
+		def := this.pre.defs[this.pre.keys[u]]
+		for ; k < nf; k++ {
+			if v := u + def[k]; this.level[v] == want {
+				this.cur[u] = int32(k)
+				return v, this.arcStart[u] + k
+			}
+		}
+	}
+
+	rev := this.revArcs[this.revStart[u]:this.revStart[u+1]]
+
+	for ; k-nf < len(rev); k++ {
+		if a := int(rev[k-nf]); this.flow[a] > this.eps {
+			if v := this.arcSource(a); this.level[v] == want {
+				this.cur[u] = int32(k)
+				return v, a
+			}
+		}
+	}
+
+	this.cur[u] = int32(k)
+
+	return MAXFLOW_UNSEEN, MAXFLOW_UNSEEN
+}
+
+// Breadth first search from every block with supply left. Returns false
+// when no block with demand left can be reached.
+func (this *MaxFlowSolver) buildLevels() bool {
+	return this.search(true)
+}
+
+// Mark everything reachable from the source in the residual network
+func (this *MaxFlowSolver) reachable() {
+	this.search(false)
+}
+
+func (this *MaxFlowSolver) search(stopAtSink bool) bool {
+
+	for i := range this.level {
+		this.level[i] = MAXFLOW_UNSEEN
+	}
+
+	this.queue = this.queue[:0]
+
+	for i, s := range this.supply {
+		if s > this.eps {
+			this.level[i] = 0
+			this.queue = append(this.queue, int32(i))
+		}
+	}
+
+	this.sinkLevel = math.MaxInt32
+
+	for head := 0; head < len(this.queue); head++ {
+
+		u := int(this.queue[head])
+
+		// Nothing beyond the closest blocks with demand is useful
+		if this.level[u] >= this.sinkLevel {
+			break
+		}
+
+		next := this.level[u] + 1
+
+		visit := func(v int) {
+			if this.level[v] == MAXFLOW_UNSEEN {
+				this.level[v] = next
+				this.queue = append(this.queue, int32(v))
+				if stopAtSink && this.demand[v] > this.eps {
+					this.sinkLevel = next
+				}
+			}
+		}
+
+		if key := this.pre.keys[u]; key != MISSING {
+			for _, off := range this.pre.defs[key] {
+				visit(u + off)
+			}
+		}
+
+		for _, a := range this.revArcs[this.revStart[u]:this.revStart[u+1]] {
+			if this.flow[a] > this.eps {
+				visit(this.arcSource(int(a)))
+			}
+		}
+	}
+
+	return this.sinkLevel != math.MaxInt32
+}
+
+// Push flow along shortest paths until the level graph is saturated
+func (this *MaxFlowSolver) blockingFlow(ctx context.Context) error {
+
+	for i := range this.cur {
+		this.cur[i] = 0
+	}
+
+	var path, arcs []int
+
+	for k, s := range this.queue {
+
+		if (k+1)%CANCEL_CHECK == 0 {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+			if this.progress.due() {
+				this.reportProgress()
+			}
+		}
+
+		if this.level[s] != 0 {
+			continue
+		}
+
+		path = append(path[:0], int(s))
+		arcs = arcs[:0]
+
+		for len(path) > 0 && this.supply[s] > this.eps {
+
+			u := path[len(path)-1]
+
+			if this.level[u] == this.sinkLevel {
+				if this.demand[u] > this.eps {
+					path, arcs = this.augment(path, arcs)
+				} else {
+					path, arcs = this.deadEnd(path, arcs)
+				}
+				continue
+			}
+
+			if v, a := this.advance(u); v != MAXFLOW_UNSEEN {
+				path = append(path, v)
+				arcs = append(arcs, a)
+			} else {
+				path, arcs = this.deadEnd(path, arcs)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Never visit the last block of the path again during this phase
+func (this *MaxFlowSolver) deadEnd(path, arcs []int) ([]int, []int) {
+
+	this.level[path[len(path)-1]] = MAXFLOW_UNSEEN
+
+	if len(arcs) > 0 {
+		arcs = arcs[:len(arcs)-1]
+	}
+
+	return path[:len(path)-1], arcs
+}
+
+// Push the bottleneck along the path, then cut the path back to the
+// first arc that was saturated.
+func (this *MaxFlowSolver) augment(path, arcs []int) ([]int, []int) {
+
+	first := path[0]
+	last := path[len(path)-1]
+
+	delta := math.Min(this.supply[first], this.demand[last])
+
+	for i, a := range arcs {
+		if this.isReverse(path[i], a) {
+			delta = math.Min(delta, this.flow[a])
+		}
+	}
+
+	this.supply[first] -= delta
+	this.demand[last] -= delta
+
+	for i, a := range arcs {
+		if this.isReverse(path[i], a) {
+			this.flow[a] -= delta
+		} else {
+			this.flow[a] += delta
+		}
+	}
+
+	for i, a := range arcs {
+		if this.isReverse(path[i], a) && this.flow[a] <= this.eps {
+			return path[:i+1], arcs[:i]
+		}
+	}
+
+	if this.demand[last] <= this.eps {
+		return this.deadEnd(path, arcs)
+	}
+
+	return path, arcs
+}
+
+// True if arc a is traversed backwards when leaving u
+func (this *MaxFlowSolver) isReverse(u, a int) bool {
+	return a < this.arcStart[u] || a >= this.arcStart[u+1]
+}
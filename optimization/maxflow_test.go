@@ -0,0 +1,78 @@
+package optimization
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The value of the selected blocks, and whether every block above that
+// they need is selected too
+func closedValue(pre *Precedence, data []float64, selected []bool) (float64, bool) {
+
+	var value float64
+
+	for i, v := range selected {
+		if !v {
+			continue
+		}
+		value += data[i]
+		if key := pre.keys[i]; key != MISSING {
+			for _, off := range pre.defs[key] {
+				if !selected[i+off] {
+					return value, false
+				}
+			}
+		}
+	}
+
+	return value, true
+}
+
+// The max flow engine finds a pit of the same value as Lerchs Grossmann
+func TestMaxFlowAgainstLG(t *testing.T) {
+
+	ctx := &Parameters{
+		Input:      Data{Grid: Grid{NumX: 7, NumY: 6, NumZ: 4, SizX: 10, SizY: 10, SizZ: 10}},
+		Precedence: Precedence{Method: BENCH, Slope: 45, NumBenches: 1},
+	}
+
+	n := ctx.Input.Grid.gridCount()
+	mask := make([]bool, n)
+	for i := range mask {
+		mask[i] = true
+	}
+
+	if e := ctx.Precedence.init(ctx, mask); e != nil {
+		t.Fatal(e)
+	}
+
+	random := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 20; trial++ {
+
+		// Mostly waste, with a few rich blocks
+		data := make([]float64, n)
+		for i := range data {
+			data[i] = -1 - float64(random.Intn(3))
+			if random.Intn(6) == 0 {
+				data[i] = float64(random.Intn(30))
+			}
+		}
+
+		lg, _ := new(LG3D).computeSolution(context.Background(), data, &ctx.Precedence)
+		mf, _ := new(MaxFlowSolver).computeSolution(context.Background(), data, &ctx.Precedence)
+
+		lgValue, lgClosed := closedValue(&ctx.Precedence, data, lg)
+		mfValue, mfClosed := closedValue(&ctx.Precedence, data, mf)
+
+		if !lgClosed || !mfClosed {
+			t.Fatalf("trial %v: pits are not closed, LG %v, max flow %v", trial, lgClosed, mfClosed)
+		}
+
+		if math.Abs(lgValue-mfValue) > 1e-9 {
+			t.Errorf("trial %v: max flow pit is worth %v, LG %v", trial, mfValue, lgValue)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package optimization
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	Mesh_OBJ = iota + 1
+	Mesh_PLY
+	Mesh_VTK
+)
+
+type (
+	// The boundary of the mined blocks, the faces between mined and unmined
+	// blocks and those on the edge of the grid. Vertices are the block
+	// corners, shared between faces, so the mesh is closed. Faces are quads
+	// wound counter clockwise seen from outside.
+	mesh struct {
+		vertices [][3]float64
+		corners  []int // lattice index of each vertex
+		faces    [][4]int
+	}
+)
+
+// The mesh format of the file, from its extension (before any .gz)
+func meshFormat(path string) (int, error) {
+
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+
+	switch ext {
+	case ".obj":
+		return Mesh_OBJ, nil
+	case ".ply":
+		return Mesh_PLY, nil
+	case ".vtk":
+		return Mesh_VTK, nil
+	}
+
+	return 0, fmt.Errorf("ERROR: mesh file %v must end in .obj, .ply or .vtk", path)
+}
+
+// The mesh of the blocks where mined is true
+func newMesh(grid *Grid, mined func(k int) bool) *mesh {
+
+	this := &mesh{}
+
+	// Vertices by their index in the lattice of block corners
+	nx, ny := grid.NumX+1, grid.NumY+1
+	index := make(map[int]int)
+
+	vertex := func(ix, iy, iz int) int {
+
+		corner := ix + iy*nx + iz*nx*ny
+
+		if v, ok := index[corner]; ok {
+			return v
+		}
+
+		// The lower corner of the block, or the upper past the last block
+		lattice := [3]int{ix, iy, iz}
+		size := [3]int{grid.NumX, grid.NumY, grid.NumZ}
+		block := lattice
+		for a := range block {
+			if block[a] == size[a] {
+				block[a]--
+			}
+		}
+
+		aabb := grid.blockAABB(grid.gridIndex(block[0], block[1], block[2]))
+
+		var p [3]float64
+		for a := range p {
+			p[a] = aabb[a]
+			if lattice[a] == size[a] {
+				p[a] = aabb[a+3]
+			}
+		}
+
+		index[corner] = len(this.vertices)
+		this.vertices = append(this.vertices, p)
+		this.corners = append(this.corners, corner)
+
+		return index[corner]
+	}
+
+	inside := func(ix, iy, iz int) bool {
+		return ix >= 0 && ix < grid.NumX && iy >= 0 && iy < grid.NumY && iz >= 0 && iz < grid.NumZ
+	}
+
+	// The corners of the face on each side of a block, counter clockwise
+	// seen from outside: -x, +x, -y, +y, -z, +z
+	sides := []struct {
+		offset  [3]int
+		corners [4][3]int
+	}{
+		{[3]int{-1, 0, 0}, [4][3]int{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}}},
+		{[3]int{1, 0, 0}, [4][3]int{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}}},
+		{[3]int{0, -1, 0}, [4][3]int{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}}},
+		{[3]int{0, 1, 0}, [4][3]int{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}}},
+		{[3]int{0, 0, -1}, [4][3]int{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}}},
+		{[3]int{0, 0, 1}, [4][3]int{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}},
+	}
+
+	for k := 0; k < grid.gridCount(); k++ {
+
+		if !mined(k) {
+			continue
+		}
+
+		ix, iy, iz := grid.gridIx(k), grid.gridIy(k), grid.gridIz(k)
+
+		for _, side := range sides {
+
+			jx, jy, jz := ix+side.offset[0], iy+side.offset[1], iz+side.offset[2]
+
+			if inside(jx, jy, jz) && mined(grid.gridIndex(jx, jy, jz)) {
+				continue
+			}
+
+			var face [4]int
+			for c, d := range side.corners {
+				face[c] = vertex(ix+d[0], iy+d[1], iz+d[2])
+			}
+
+			this.faces = append(this.faces, face)
+		}
+	}
+
+	return this
+}
+
+// Round off the stair steps of the benches with Laplacian smoothing, moving
+// each vertex to the mean of its neighbours. This does not fit the surface
+// to the slope: a vertex moves no more than half a block along each axis,
+// and not at all off the sides, top or bottom of the grid.
+func (this *mesh) smooth(grid *Grid, iterations int) {
+
+	if iterations <= 0 || len(this.vertices) == 0 {
+		return
+	}
+
+	// The neighbours of each vertex along the face edges
+	neighbours := make([]map[int]bool, len(this.vertices))
+	for i := range neighbours {
+		neighbours[i] = make(map[int]bool)
+	}
+
+	for _, face := range this.faces {
+		for c := range face {
+			a, b := face[c], face[(c+1)%4]
+			neighbours[a][b] = true
+			neighbours[b][a] = true
+		}
+	}
+
+	nx, ny := grid.NumX+1, grid.NumY+1
+	half := [3]float64{grid.SizX / 2, grid.SizY / 2, grid.SizZ / 2}
+	original := make([][3]float64, len(this.vertices))
+	copy(original, this.vertices)
+
+	// The axes a vertex may move along, those it is not on the edge of
+	free := make([][3]bool, len(this.vertices))
+	for v, corner := range this.corners {
+		lattice := [3]int{corner % nx, (corner / nx) % ny, corner / (nx * ny)}
+		size := [3]int{grid.NumX, grid.NumY, grid.NumZ}
+		for a := range lattice {
+			free[v][a] = lattice[a] > 0 && lattice[a] < size[a]
+		}
+	}
+
+	next := make([][3]float64, len(this.vertices))
+
+	for it := 0; it < iterations; it++ {
+
+		for v, p := range this.vertices {
+
+			var mean [3]float64
+			for n := range neighbours[v] {
+				for a := range mean {
+					mean[a] += this.vertices[n][a]
+				}
+			}
+
+			for a := range mean {
+				next[v][a] = p[a]
+				if free[v][a] && len(neighbours[v]) > 0 {
+					q := mean[a] / float64(len(neighbours[v]))
+					q = math.Max(q, original[v][a]-half[a])
+					q = math.Min(q, original[v][a]+half[a])
+					next[v][a] = q
+				}
+			}
+		}
+
+		this.vertices, next = next, this.vertices
+	}
+}
+
+// Write the mesh of each row, or of each of the nested shells or phases of
+// each row. The files are numbered by realization, then by the 1 indexed
+// shell or phase, if there is more than one.
+func writeMeshFiles(ctx context.Context, files *outputFiles, path string, grid *Grid, rows [][]int, nested int, smoothing int) error {
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	format, _ := meshFormat(path)
+
+	pits := nested
+	if pits == 0 {
+		pits = 1
+	}
+
+	for r, row := range rows {
+		for s := 1; s <= pits; s++ {
+
+			var numbers []int
+			if len(rows) > 1 {
+				numbers = append(numbers, r)
+			}
+			if nested > 0 {
+				numbers = append(numbers, s)
+			}
+
+			file := numberedFileName(path, numbers...)
+
+			log.Infof("Writing the pit mesh to %v", file)
+
+			// A block is in shell s, and every later shell, from the shell
+			// that first mines it, and likewise for phases
+			m := newMesh(grid, func(k int) bool { return row[k] != 0 && row[k] <= s })
+			m.smooth(grid, smoothing)
+
+			e := files.write(ctx, file, func(writer io.Writer) error {
+				return m.write(ctx, writer, format)
+			})
+
+			if e != nil {
+				return e
+			}
+		}
+	}
+
+	return nil
+}
+
+func (this *mesh) write(ctx context.Context, writer io.Writer, format int) error {
+
+	buffer := bufio.NewWriter(writer)
+
+	switch format {
+	case Mesh_OBJ:
+		this.writeObj(buffer)
+	case Mesh_PLY:
+		this.writePly(buffer)
+	case Mesh_VTK:
+		this.writeVtk(buffer)
+	}
+
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+
+	if e := buffer.Flush(); e != nil {
+		e = fmt.Errorf("ERROR: failed writing mesh: %v", e)
+		log.Error(e)
+		return &OutputError{e}
+	}
+
+	return nil
+}
+
+// Wavefront OBJ, the vertices are 1 indexed
+func (this *mesh) writeObj(w io.Writer) {
+
+	fmt.Fprintln(w, "# ultpit pit mesh")
+	fmt.Fprintln(w, "o pit")
+
+	for _, p := range this.vertices {
+		fmt.Fprintf(w, "v %v %v %v\n", p[0], p[1], p[2])
+	}
+
+	for _, f := range this.faces {
+		fmt.Fprintf(w, "f %v %v %v %v\n", f[0]+1, f[1]+1, f[2]+1, f[3]+1)
+	}
+}
+
+// ASCII PLY
+func (this *mesh) writePly(w io.Writer) {
+
+	fmt.Fprintln(w, "ply")
+	fmt.Fprintln(w, "format ascii 1.0")
+	fmt.Fprintln(w, "comment ultpit pit mesh")
+	fmt.Fprintf(w, "element vertex %v\n", len(this.vertices))
+	fmt.Fprintln(w, "property double x")
+	fmt.Fprintln(w, "property double y")
+	fmt.Fprintln(w, "property double z")
+	fmt.Fprintf(w, "element face %v\n", len(this.faces))
+	fmt.Fprintln(w, "property list uchar int vertex_indices")
+	fmt.Fprintln(w, "end_header")
+
+	for _, p := range this.vertices {
+		fmt.Fprintf(w, "%v %v %v\n", p[0], p[1], p[2])
+	}
+
+	for _, f := range this.faces {
+		fmt.Fprintf(w, "4 %v %v %v %v\n", f[0], f[1], f[2], f[3])
+	}
+}
+
+// Legacy ASCII VTK polygon data
+func (this *mesh) writeVtk(w io.Writer) {
+
+	fmt.Fprintln(w, "# vtk DataFile Version 3.0")
+	fmt.Fprintln(w, "ultpit pit mesh")
+	fmt.Fprintln(w, "ASCII")
+	fmt.Fprintln(w, "DATASET POLYDATA")
+	fmt.Fprintf(w, "POINTS %v double\n", len(this.vertices))
+
+	for _, p := range this.vertices {
+		fmt.Fprintf(w, "%v %v %v\n", p[0], p[1], p[2])
+	}
+
+	fmt.Fprintf(w, "POLYGONS %v %v\n", len(this.faces), 5*len(this.faces))
+
+	for _, f := range this.faces {
+		fmt.Fprintf(w, "4 %v %v %v %v\n", f[0], f[1], f[2], f[3])
+	}
+}
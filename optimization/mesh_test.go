@@ -0,0 +1,206 @@
+package optimization
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Check every edge is shared by two faces, once in each direction, so the
+// mesh is closed and its faces all wound the same way
+func checkClosed(t *testing.T, m *mesh) {
+
+	edges := make(map[[2]int]int)
+
+	for _, face := range m.faces {
+		for c := range face {
+			edges[[2]int{face[c], face[(c+1)%4]}]++
+		}
+	}
+
+	for edge, n := range edges {
+		if n != 1 || edges[[2]int{edge[1], edge[0]}] != 1 {
+			t.Fatalf("edge %v is used %v times, its reverse %v", edge, n, edges[[2]int{edge[1], edge[0]}])
+		}
+	}
+
+	// A closed surface without holes
+	if euler := len(m.vertices) - len(edges)/2 + len(m.faces); euler != 2 {
+		t.Errorf("Euler characteristic %v, want 2", euler)
+	}
+}
+
+func TestMeshClosed(t *testing.T) {
+
+	grid := &Grid{NumX: 3, NumY: 3, NumZ: 2, SizX: 10, SizY: 10, SizZ: 5}
+
+	tests := []struct {
+		name     string
+		blocks   [][3]int
+		vertices int
+		faces    int
+	}{
+		{"block", [][3]int{{1, 1, 1}}, 8, 6},
+		{"pair", [][3]int{{0, 1, 1}, {1, 1, 1}}, 12, 10},
+		{"step", [][3]int{{0, 0, 1}, {1, 0, 1}, {0, 0, 0}}, 16, 14},
+	}
+
+	for _, test := range tests {
+
+		mined := make([]bool, grid.gridCount())
+		for _, b := range test.blocks {
+			mined[grid.gridIndex(b[0], b[1], b[2])] = true
+		}
+
+		m := newMesh(grid, func(k int) bool { return mined[k] })
+
+		if len(m.vertices) != test.vertices || len(m.faces) != test.faces {
+			t.Errorf("%v: %v vertices and %v faces, want %v and %v",
+				test.name, len(m.vertices), len(m.faces), test.vertices, test.faces)
+		}
+
+		checkClosed(t, m)
+	}
+}
+
+// Smoothing keeps the mesh closed, moves no vertex more than half a block
+// and none off the sides, top or bottom of the grid
+func TestMeshSmooth(t *testing.T) {
+
+	grid := &Grid{NumX: 4, NumY: 3, NumZ: 3, SizX: 10, SizY: 10, SizZ: 6}
+
+	// A pit one bench deeper towards the middle
+	m := newMesh(grid, func(k int) bool {
+		return grid.gridIz(k) == 2 || (grid.gridIz(k) == 1 && grid.gridIx(k) > 0 && grid.gridIx(k) < 3)
+	})
+
+	before := make([][3]float64, len(m.vertices))
+	copy(before, m.vertices)
+
+	m.smooth(grid, 10)
+
+	checkClosed(t, m)
+
+	half := [3]float64{5, 5, 3}
+	high := [3]float64{40, 30, 18}
+	moved := false
+
+	for v, p := range m.vertices {
+		for a := range p {
+			if d := p[a] - before[v][a]; d > half[a]+1e-9 || d < -half[a]-1e-9 {
+				t.Errorf("vertex %v moved from %v to %v", v, before[v], p)
+			} else if d != 0 {
+				moved = true
+				if before[v][a] == 0 || before[v][a] == high[a] {
+					t.Errorf("vertex %v moved off the grid edge, from %v to %v", v, before[v], p)
+				}
+			}
+		}
+	}
+
+	if !moved {
+		t.Error("smoothing moved nothing")
+	}
+}
+
+func TestMeshFormats(t *testing.T) {
+
+	grid := &Grid{NumX: 1, NumY: 1, NumZ: 1, SizX: 1, SizY: 1, SizZ: 1}
+	m := newMesh(grid, func(int) bool { return true })
+
+	tests := []struct {
+		format int
+		want   []string
+	}{
+		{Mesh_OBJ, []string{"o pit\n", "\nf "}},
+		{Mesh_PLY, []string{"element vertex 8\n", "element face 6\n", "end_header\n"}},
+		{Mesh_VTK, []string{"POINTS 8 double\n", "POLYGONS 6 30\n"}},
+	}
+
+	for _, test := range tests {
+
+		var buffer bytes.Buffer
+
+		if e := m.write(context.Background(), &buffer, test.format); e != nil {
+			t.Fatal(e)
+		}
+
+		for _, w := range test.want {
+			if !strings.Contains(buffer.String(), w) {
+				t.Errorf("format %v: no %q in\n%v", test.format, w, buffer.String())
+			}
+		}
+	}
+
+	if _, e := meshFormat("pit.stl"); e == nil {
+		t.Error("pit.stl accepted")
+	}
+}
+
+// A file per realization and shell, each shell holding those before it
+func TestMeshFiles(t *testing.T) {
+
+	grid := &Grid{NumX: 2, NumY: 1, NumZ: 1, SizX: 1, SizY: 1, SizZ: 1}
+	rows := [][]int{{1, 2}, {2, 0}}
+	path := filepath.Join(t.TempDir(), "pit.ply")
+
+	files := &outputFiles{}
+
+	if e := writeMeshFiles(context.Background(), files, path, grid, rows, 2, 0); e != nil {
+		t.Fatal(e)
+	}
+
+	if e := files.commit(); e != nil {
+		t.Fatal(e)
+	}
+
+	want := map[string]int{"pit_0_1.ply": 6, "pit_0_2.ply": 10, "pit_1_1.ply": 0, "pit_1_2.ply": 6}
+
+	for name, faces := range want {
+
+		text, e := os.ReadFile(filepath.Join(filepath.Dir(path), name))
+
+		if e != nil {
+			t.Fatal(e)
+		}
+
+		if !strings.Contains(string(text), fmt.Sprintf("element face %v\n", faces)) {
+			t.Errorf("%v does not have %v faces:\n%v", name, faces, string(text))
+		}
+	}
+}
+
+// A schedule of the shells meshes the shells, not the periods
+func TestMeshScheduledShells(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// From the bottom up, the top block is the first shell and the rest the
+	// second
+	opt := MiningOptParams{
+		InputFile:  writeTestGzip(t, "model.gz", "6\n-4\n2\n"),
+		OutputFile: filepath.Join(dir, "periods.txt"),
+		MeshFile:   filepath.Join(dir, "pit.ply"),
+		ParamFile: writeTestFile(t, "params.json", `{
+			"input": {"type": 2, "grid": {"num_x": 1, "num_y": 1, "num_z": 3, "siz_x": 10, "siz_y": 10, "siz_z": 10}},
+			"precedence": {"method": 1, "slope": 45, "num_benches": 1},
+			"optimization": {"engine": 1},
+			"shells": {"revenue_factors": [0.5, 1], "density": 1},
+			"schedule": {"mining_capacity": 1000}
+		}`),
+	}
+
+	if e := DoMiningOptimization(opt); e != nil {
+		t.Fatal(e)
+	}
+
+	for name, want := range map[string]bool{"pit_1.ply": true, "pit_2.ply": true, "pit_3.ply": false} {
+		if _, e := os.Stat(filepath.Join(dir, name)); (e == nil) != want {
+			t.Errorf("%v written %v, want %v", name, e == nil, want)
+		}
+	}
+}
@@ -2,90 +2,284 @@ package optimization
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	log "github.com/cihub/seelog"
 )
 
 type (
+	// The output files written, waiting to be renamed into place together
+	outputFiles struct {
+		temps []string
+		paths []string
+	}
+
 	MiningOptParams struct {
-		InputFile  string
-		OutputFile string
-		ParamFile  string
+		InputFile        string
+		OutputFile       string
+		ParamFile        string
+		Progress         ProgressFunc  // Called with the progress of the engines, if any
+		ProgressInterval time.Duration // Between calls, DEFAULT_PROGRESS_INTERVAL if not positive
+		Workers          int           // Realizations solved at once, at least 1
+		MemoryLimit      int64         // Bytes the workers may use, GOMEMLIMIT if not positive
+		Probability      bool          // Add the probability column to the output
+		SurfaceFile      string        // If given, the pit surface, as .asc, .xyz, .obj or .stl
+		MeshFile         string        // If given, the boundary of the pit or of each shell, as .obj, .ply or .vtk
+		MeshSmoothing    int           // Iterations smoothing the mesh, none if not positive
+		TopographyFile   string        // If given, the current surface, as .asc or .xyz, the blocks above it are air
 	}
 )
 
-var H string
+// Read the parameters and input, solve and write the pits (or shells). The
+// error is one of ParameterError, InputError, EngineError, SolverError or
+// OutputError.
+func DoMiningOptimization(opt MiningOptParams) error {
+	return DoMiningOptimizationContext(context.Background(), opt)
+}
 
-func DoMiningOptimization(opt MiningOptParams) {
+// As DoMiningOptimization, but stops when the context ends and returns its
+// error. The output file is only written once everything has been solved.
+func DoMiningOptimizationContext(ctx context.Context, opt MiningOptParams) error {
 
 	log.Info("Being parsing parameters")
 
 	var params Parameters
 
-	if readJsonFile(opt.ParamFile, &params) != nil {
-		return
+	if e := readJsonFile(opt.ParamFile, &params); e != nil {
+		return &ParameterError{e}
+	}
+
+	// The probability flag adds its column to those configured
+	if opt.Probability {
+		params.Output.addColumn("probability", params.title())
+	}
+
+	if e := params.Output.check(params.title()); e != nil {
+		log.Error(e)
+		return &ParameterError{e}
+	}
+
+	if e := params.Schedule.check(); e != nil {
+		log.Error(e)
+		return &ParameterError{e}
+	}
+
+	if len(opt.SurfaceFile) > 0 {
+		if _, e := surfaceFormat(opt.SurfaceFile); e != nil {
+			log.Error(e)
+			return &ParameterError{e}
+		}
+	}
+
+	if len(opt.TopographyFile) > 0 {
+		if _, e := topographyFormat(opt.TopographyFile); e != nil {
+			log.Error(e)
+			return &ParameterError{e}
+		}
+	}
+
+	if len(opt.MeshFile) > 0 {
+		if _, e := meshFormat(opt.MeshFile); e != nil {
+			log.Error(e)
+			return &ParameterError{e}
+		}
 	}
 
+	params.progress = newProgressReporter(opt.Progress, opt.ProgressInterval)
+	params.workers = opt.Workers
+	params.memoryLimit = opt.MemoryLimit
+
 	log.Info("Begin reading input")
-	H = opt.InputFile
-	if params.Input.initializeFromGzip(opt.InputFile) != nil {
-		return
+	if e := params.readInput(opt.InputFile); e != nil {
+		return e
+	} else if e = ctx.Err(); e != nil {
+		return e
+	}
+
+	if len(opt.TopographyFile) > 0 {
+		if e := params.readTopography(opt.TopographyFile); e != nil {
+			return e
+		}
+	}
+
+	// The column written for each block of each realization
+	title := params.title()
+	var rows [][]int
+	var e error
+
+	if params.Phases.enabled() {
+		rows, e = params.optimizingPhases(ctx)
+	} else if params.Shells.enabled() {
+		rows, e = params.optimizingShells(ctx)
+	} else {
+		rows, e = params.optimizingRows(ctx)
+	}
+
+	// The meshes are of the pits, shells or phases, not the periods
+	pits := rows
+
+	if e == nil && params.Schedule.enabled() {
+		rows, e = params.scheduling(ctx, rows)
+	}
+
+	if e != nil {
+		log.Error("ERROR: failed optimizing")
+		return e
 	}
 
-	selection, status := params.optimizing()
+	table := &outputTable{
+		title: title,
+		grid:  &params.Input.Grid,
+		rows:  rows,
+		ebv:   outputEbv(&params.Input, len(rows)),
+		prob:  probability(rows),
+	}
 
-	if status != 0 {
-		log.Info("ERROR: failed optimizing")
-		return
+	if params.Output.hasColumn("probability", title) {
+		logProbability(table.prob)
 	}
 
-	var writer io.Writer
-	var write_head bool
-	var doclose func() error
+	// Every file is written before any is renamed into place
+	files := &outputFiles{}
 
 	if len(opt.OutputFile) == 0 {
-		writer = os.Stdout
-		write_head = true
+		e = writeOutput(ctx, os.Stdout, &params.Output, true, table)
 	} else {
+		e = files.write(ctx, opt.OutputFile, func(writer io.Writer) error {
+			return writeOutput(ctx, writer, &params.Output, false, table)
+		})
+	}
 
-		file, e := os.Create(opt.OutputFile)
-		if e != nil {
-			log.Infof("Failed to create output file %v: %v", opt.OutputFile, e)
-			return
-		}
-		defer file.Close()
-		writer = file
-
-		if strings.HasSuffix(opt.OutputFile, ".gz") {
-			zipwriter := gzip.NewWriter(writer)
-			doclose = zipwriter.Close
-			writer = zipwriter
-		} else {
-			write_head = false
-		}
+	if e == nil {
+		e = writeSurfaceFiles(ctx, files, opt.SurfaceFile, table.grid, rows, params.Input.Topography)
 	}
 
-	if write_head {
-		fmt.Fprintln(writer, "ultpit output")
-		fmt.Fprintln(writer, "1")
-		fmt.Fprintln(writer, "Pit")
+	if e == nil {
+		e = writeMeshFiles(ctx, files, opt.MeshFile, table.grid, pits, params.nested(pits), opt.MeshSmoothing)
 	}
 
-	for _, row := range selection {
-		for _, v := range row {
+	if e == nil {
+		e = ctx.Err()
+	}
+
+	if e != nil {
+		files.discard()
+		return e
+	}
+
+	return files.commit()
+}
+
+// Solve the pits, 1 where a block is mined and 0 where not
+func (ctx *Parameters) optimizingRows(cx context.Context) ([][]int, error) {
+
+	result, e := ctx.optimizing(cx)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return pitRows(result), nil
+}
+
+// The pits as rows, 1 where a block is mined and 0 where not
+func pitRows(result *Result) [][]int {
+
+	rows := make([][]int, len(result.Pits))
+
+	for r, pit := range result.Pits {
+		rows[r] = make([]int, len(pit.Selected))
+		for i, v := range pit.Selected {
 			if v {
-				fmt.Fprintln(writer, "1")
-			} else {
-				fmt.Fprintln(writer, "0")
+				rows[r][i] = 1
 			}
 		}
 	}
 
-	if doclose != nil {
-		doclose()
+	return rows
+}
+
+// Write the file through write, gzipped if it ends in .gz. It is written
+// beside the file, and renamed on commit, so it is never left partial.
+func (this *outputFiles) write(ctx context.Context, path string, write func(io.Writer) error) error {
+
+	dir, base := filepath.Split(path)
+	if len(dir) == 0 {
+		dir = "."
+	}
+
+	file, e := ioutil.TempFile(dir, "."+base+".")
+
+	if e != nil {
+		e = fmt.Errorf("ERROR: failed to create output file %v: %v", path, e)
+		log.Error(e)
+		return &OutputError{e}
+	}
+
+	var writer io.Writer = file
+	var zipwriter *gzip.Writer
+
+	if strings.HasSuffix(path, ".gz") {
+		zipwriter = gzip.NewWriter(file)
+		writer = zipwriter
+	}
+
+	if e = write(writer); e == nil && zipwriter != nil {
+		e = zipwriter.Close()
+	}
+
+	if e == nil {
+		e = file.Chmod(0644)
+	}
+
+	if ce := file.Close(); e == nil {
+		e = ce
+	}
+
+	if e != nil {
+		os.Remove(file.Name())
+		if !isTyped(e) {
+			e = fmt.Errorf("ERROR: failed writing output file %v: %v", path, e)
+			log.Error(e)
+		}
+		return outputError(e)
+	}
+
+	this.temps = append(this.temps, file.Name())
+	this.paths = append(this.paths, path)
+
+	return nil
+}
+
+// Rename every file written into place
+func (this *outputFiles) commit() error {
+
+	for i, temp := range this.temps {
+		if e := os.Rename(temp, this.paths[i]); e != nil {
+			this.temps = this.temps[i:]
+			this.discard()
+			e = fmt.Errorf("ERROR: failed writing output file %v: %v", this.paths[i], e)
+			log.Error(e)
+			return &OutputError{e}
+		}
+	}
+
+	this.temps = nil
+
+	return nil
+}
+
+// Remove every file written and not renamed
+func (this *outputFiles) discard() {
+	for _, temp := range this.temps {
+		os.Remove(temp)
 	}
+	this.temps = nil
 }
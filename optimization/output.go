@@ -0,0 +1,208 @@
+package optimization
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	Output_PLAIN = iota + 1
+	Output_GSLIB
+	Output_CSV
+)
+
+type (
+	// How the output is written. Each block of each realization is a line,
+	// the realizations following one another, with the named columns:
+	//   x, y, z      the centroid of the block
+	//   realization  0 indexed
+	//   pit          1 if the block is mined, otherwise 0
+	//   shell        the 1 indexed shell that mines the block, 0 if none
+	//   phase        the 1 indexed phase that mines the block, 0 if none
+	//   period       the 1 indexed period that mines the block, 0 if none
+	//   ebv          the value of the block, the mean for a stochastic pit
+	//   probability  the fraction of the realizations mining the block
+	// Sparse skips the blocks that are not mined.
+	OutputParam struct {
+		Format  int      `json:"format"`
+		Columns []string `json:"columns"`
+		Sparse  bool     `json:"sparse"`
+	}
+
+	// The results to write, one row per realization of one value per block,
+	// 0 where the block is not mined
+	outputTable struct {
+		title string
+		grid  *Grid
+		rows  [][]int
+		ebv   [][]float64
+		prob  []float64
+	}
+)
+
+func (this *OutputParam) format() int {
+	if this.Format == 0 {
+		return Output_PLAIN
+	}
+	return this.Format
+}
+
+// The columns to write, the pit, shell or phase alone if none are given
+func (this *OutputParam) columns(title string) []string {
+
+	if len(this.Columns) > 0 {
+		return this.Columns
+	}
+
+	return []string{strings.ToLower(title)}
+}
+
+func (this *OutputParam) hasColumn(name string, title string) bool {
+
+	for _, c := range this.columns(title) {
+		if c == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add the column to those written, if it is not there already
+func (this *OutputParam) addColumn(name string, title string) {
+
+	if !this.hasColumn(name, title) {
+		this.Columns = append(this.columns(title), name)
+	}
+}
+
+// Check the columns can be written for the title, Pit, Shell or Phase
+func (this *OutputParam) check(title string) error {
+
+	switch this.format() {
+	case Output_PLAIN, Output_GSLIB, Output_CSV:
+	default:
+		return fmt.Errorf("ERROR: invalid output format: %v", this.Format)
+	}
+
+	located := 0
+
+	for _, c := range this.columns(title) {
+		switch c {
+		case "x", "y", "z":
+			located++
+		case "realization", "pit", "ebv", "probability":
+		case "shell", "phase", "period":
+			if c != strings.ToLower(title) {
+				return fmt.Errorf("ERROR: the %v column needs %vs", c, c)
+			}
+		default:
+			return fmt.Errorf("ERROR: invalid output column: %v", c)
+		}
+	}
+
+	if this.Sparse && located < 3 {
+		return fmt.Errorf("ERROR: sparse output needs the x, y and z columns")
+	}
+
+	return nil
+}
+
+// The value of each block written for the ebv column of each row. A single
+// stochastic pit gets the mean of the realizations.
+func outputEbv(data *Data, rows int) [][]float64 {
+
+	if rows == len(data.Ebv) {
+		return data.Ebv
+	}
+
+	mean := make([]float64, len(data.Ebv[0]))
+
+	for _, layer := range data.Ebv {
+		for i, v := range layer {
+			mean[i] += v / float64(len(data.Ebv))
+		}
+	}
+
+	return [][]float64{mean}
+}
+
+// Write the table, with the header of the format if write_head. GSLIB and
+// CSV always have one, plain output only if asked.
+func writeOutput(ctx context.Context, writer io.Writer, param *OutputParam, write_head bool, table *outputTable) error {
+
+	// The buffer keeps the first write error
+	buffer := bufio.NewWriter(writer)
+
+	columns := param.columns(table.title)
+	separator := " "
+
+	if param.format() == Output_CSV {
+		separator = ","
+		fmt.Fprintln(buffer, strings.Join(columns, separator))
+	} else if write_head || param.format() == Output_GSLIB {
+		fmt.Fprintln(buffer, "ultpit output")
+		fmt.Fprintln(buffer, len(columns))
+		for _, c := range columns {
+			// As the single column has always been named
+			if len(columns) == 1 && c == strings.ToLower(table.title) {
+				c = table.title
+			}
+			fmt.Fprintln(buffer, c)
+		}
+	}
+
+	fields := make([]string, len(columns))
+
+	for r, row := range table.rows {
+
+		if e := ctx.Err(); e != nil {
+			return e
+		}
+
+		for i, v := range row {
+
+			if param.Sparse && v == 0 {
+				continue
+			}
+
+			for c, name := range columns {
+				switch name {
+				case "x", "y", "z":
+					centroid := table.grid.blockCentroid2(i)
+					fields[c] = strconv.FormatFloat(centroid[name[0]-'x'], 'f', -1, 64)
+				case "realization":
+					fields[c] = strconv.Itoa(r)
+				case "pit":
+					if v != 0 {
+						fields[c] = "1"
+					} else {
+						fields[c] = "0"
+					}
+				case "shell", "phase", "period":
+					fields[c] = strconv.Itoa(v)
+				case "ebv":
+					fields[c] = strconv.FormatFloat(table.ebv[r][i], 'f', -1, 64)
+				case "probability":
+					fields[c] = strconv.FormatFloat(table.prob[i], 'f', -1, 64)
+				}
+			}
+
+			fmt.Fprintln(buffer, strings.Join(fields, separator))
+		}
+	}
+
+	if e := buffer.Flush(); e != nil {
+		e = fmt.Errorf("ERROR: failed writing output: %v", e)
+		log.Error(e)
+		return &OutputError{e}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package optimization
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// Two blocks side by side, the first mined in the first realization and
+// both in the second
+func outputTestTable() *outputTable {
+
+	rows := [][]int{{1, 0}, {2, 1}}
+
+	return &outputTable{
+		title: "Shell",
+		grid:  &Grid{NumX: 2, NumY: 1, NumZ: 1, MinX: 100, SizX: 10, SizY: 10, SizZ: 5},
+		rows:  rows,
+		ebv:   [][]float64{{1.5, -2}, {3, -4}},
+		prob:  probability(rows),
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		param OutputParam
+		head  bool
+		want  string
+	}{
+		{
+			"plain", OutputParam{}, false,
+			"1\n0\n2\n1\n",
+		},
+		{
+			"stdout", OutputParam{}, true,
+			"ultpit output\n1\nShell\n1\n0\n2\n1\n",
+		},
+		{
+			"gslib", OutputParam{Format: Output_GSLIB, Columns: []string{"realization", "shell", "ebv"}}, false,
+			"ultpit output\n3\nrealization\nshell\nebv\n0 1 1.5\n0 0 -2\n1 2 3\n1 1 -4\n",
+		},
+		{
+			// The grid is the corner of the first block
+			"csv", OutputParam{Format: Output_CSV, Columns: []string{"x", "y", "z", "pit", "probability"}}, false,
+			"x,y,z,pit,probability\n105,5,2.5,1,1\n115,5,2.5,0,0.5\n105,5,2.5,1,1\n115,5,2.5,1,0.5\n",
+		},
+		{
+			"sparse", OutputParam{Format: Output_CSV, Columns: []string{"x", "y", "z", "shell"}, Sparse: true}, false,
+			"x,y,z,shell\n105,5,2.5,1\n105,5,2.5,2\n115,5,2.5,1\n",
+		},
+	}
+
+	for _, test := range tests {
+
+		if e := test.param.check("Shell"); e != nil {
+			t.Fatalf("%v: %v", test.name, e)
+		}
+
+		var buffer bytes.Buffer
+
+		if e := writeOutput(context.Background(), &buffer, &test.param, test.head, outputTestTable()); e != nil {
+			t.Fatalf("%v: %v", test.name, e)
+		}
+
+		if got := buffer.String(); got != test.want {
+			t.Errorf("%v: wrote %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOutputCheck(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		param OutputParam
+		title string
+	}{
+		{"format", OutputParam{Format: 4}, "Pit"},
+		{"column", OutputParam{Columns: []string{"grade"}}, "Pit"},
+		{"shell", OutputParam{Columns: []string{"shell"}}, "Pit"},
+		{"phase", OutputParam{Columns: []string{"phase"}}, "Shell"},
+		{"sparse", OutputParam{Columns: []string{"x", "y", "pit"}, Sparse: true}, "Pit"},
+	}
+
+	for _, test := range tests {
+		if test.param.check(test.title) == nil {
+			t.Errorf("%v: accepted %+v", test.name, test.param)
+		}
+	}
+
+	// The probability is added once, after the default column
+	param := OutputParam{}
+	param.addColumn("probability", "Shell")
+	param.addColumn("probability", "Shell")
+
+	if len(param.Columns) != 2 || param.Columns[0] != "shell" || param.Columns[1] != "probability" {
+		t.Errorf("columns are %v, want [shell probability]", param.Columns)
+	}
+}
+
+// A single stochastic pit is written with the mean values
+func TestOutputEbv(t *testing.T) {
+
+	data := &Data{Ebv: [][]float64{{1, 4}, {3, -2}}}
+
+	if got := outputEbv(data, 2); len(got) != 2 || got[1][1] != -2 {
+		t.Errorf("got %v, want the realizations", got)
+	}
+
+	if got := outputEbv(data, 1); len(got) != 1 || got[0][0] != 2 || got[0][1] != 1 {
+		t.Errorf("got %v, want [[2 1]]", got)
+	}
+}
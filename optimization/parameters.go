@@ -1,6 +1,10 @@
 package optimization
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	log "github.com/cihub/seelog"
 )
 
@@ -9,48 +13,99 @@ type (
 		Input       Data `json:"input"`
 		Precedence  `json:"precedence"`
 		EngineParam `json:"optimization"`
+		Shells      ShellParam      `json:"shells"`
+		Phases      PhaseParam      `json:"phases"`
+		Schedule    ScheduleParam   `json:"schedule"`
+		Stochastic  StochasticParam `json:"stochastic"`
+		Discount    DiscountParam   `json:"discount"`
+		Constraints ConstraintParam `json:"constraints"`
+		Economics   Economics       `json:"economics"`
+		Output      OutputParam     `json:"output"`
+		progress    *progressReporter
+		workers     int
+		memoryLimit int64
+		included    []bool // Blocks added to every pit, if any
 	}
 )
 
-func (ctx *Parameters) optimizing() ([][]bool, int) {
+// Read the input, calculating the EBVs when economics are supplied, and
+// any zone codes the precedence needs.
+func (ctx *Parameters) readInput(infile string) error {
 
-	nReal := len(ctx.Input.Ebv)
-	nData := len(ctx.Input.Ebv[0])
+	var e error
 
-	log.Infof("Number of realizations: %v", nReal)
-	log.Infof("Number of rows: %v", nData)
+	if ctx.Economics.enabled() {
+		e = ctx.Economics.initialize(&ctx.Input, infile)
+	} else {
+		e = ctx.Input.initialize(infile)
+	}
 
-	log.Info("Begin creating naive mask")
-	mask := ctx.generateMask()
+	if e == nil && ctx.Precedence.Method == ZONES {
+		e = ctx.Precedence.Zones.initialize(&ctx.Input, infile)
+	}
 
-	log.Info("Begin creating precedence")
-	if ctx.Precedence.init(ctx, mask) != nil {
-		return nil, -1
+	return e
+}
+
+// The column the output holds for each block, Pit, Shell, Phase or Period
+func (ctx *Parameters) title() string {
+	if ctx.Schedule.enabled() {
+		return "Period"
+	} else if ctx.Phases.enabled() {
+		return "Phase"
+	} else if ctx.Shells.enabled() {
+		return "Shell"
 	}
+	return "Pit"
+}
 
-	//--------------------------------------------------
+// The number of nested shells or phases in the rows, or 0 for pits
+func (ctx *Parameters) nested(rows [][]int) int {
 
-	log.Info("Updating mask")
-	for i := 0; i < nData; i++ {
-		if mask[i] {
-			if key := ctx.Precedence.keys[i]; key != MISSING {
-				for _, off := range ctx.Precedence.defs[key] {
-					mask[i+off] = true
-				}
+	if !ctx.Phases.enabled() && !ctx.Shells.enabled() {
+		return 0
+	}
+
+	n := 0
+	for _, row := range rows {
+		for _, v := range row {
+			if v > n {
+				n = v
 			}
 		}
 	}
 
-	//--------------------------------------------------
+	return n
+}
 
-	log.Info("Begin compressing")
+func (ctx *Parameters) optimizing(cx context.Context) (*Result, error) {
 
-	var condensedEBV Data
-	var condensedPre Precedence
+	if ctx.Discount.enabled() {
+		return ctx.optimizingDiscounted(cx)
+	}
 
-	if !compressEverything(mask, &ctx.Input, &ctx.Precedence, &condensedEBV, &condensedPre) {
-		log.Info("ERROR: Compressing everything failed")
-		return nil, 1
+	return ctx.optimizingUndiscounted(cx)
+}
+
+func (ctx *Parameters) optimizingUndiscounted(cx context.Context) (*Result, error) {
+
+	if ctx.Stochastic.enabled() {
+		return ctx.optimizingStochastic(cx)
+	}
+
+	return ctx.optimizingPits(cx)
+}
+
+// Solve the pit of every realization
+func (ctx *Parameters) optimizingPits(cx context.Context) (*Result, error) {
+
+	start := time.Now()
+	nReal := len(ctx.Input.Ebv)
+
+	mask, condensedEBV, condensedPre, e := ctx.prepare(cx)
+
+	if e != nil {
+		return nil, e
 	}
 
 	// allocate the condensedSolutions
@@ -62,20 +117,9 @@ func (ctx *Parameters) optimizing() ([][]bool, int) {
 
 	log.Info("Begin optimizing")
 
-	for r := 0; r < nReal; r++ {
-
-		engine, e := getEngine(&ctx.EngineParam)
-
-		if engine == nil {
-			log.Info("Error: failed initializing optimization engine: %v", e)
-			return nil, 1
-		}
-
-		row, status := engine.computeSolution(condensedEBV.Ebv[r], &condensedPre)
+	values := func(r int) []float64 { return condensedEBV.Ebv[r] }
 
-		if status != 0 {
-			return nil, status
-		}
+	e = ctx.solveAll(cx, nReal, values, condensedPre, func(r int, row []bool) {
 
 		solutions[r] = row
 
@@ -89,6 +133,10 @@ func (ctx *Parameters) optimizing() ([][]bool, int) {
 			}
 		}
 		log.Infof("Completed realization %3v. Blocks: %-6v, EBV: %f", r, count, ebv)
+	})
+
+	if e != nil {
+		return nil, e
 	}
 
 	//--------------------------------------------------
@@ -96,6 +144,113 @@ func (ctx *Parameters) optimizing() ([][]bool, int) {
 
 	log.Info("Decompressing solutions")
 
+	result := &Result{Statistics: condensedPre.statistics(len(mask))}
+
+	for r, selected := range ctx.decompress(mask, solutions) {
+		result.Pits = append(result.Pits, newPit(selected, ctx.Input.Ebv[r]))
+	}
+
+	result.Statistics.Elapsed = time.Since(start)
+
+	return result, nil
+}
+
+// Build the mask and precedence, then compress both
+func (ctx *Parameters) prepare(cx context.Context) ([]bool, *Data, *Precedence, error) {
+
+	nReal := len(ctx.Input.Ebv)
+	nData := len(ctx.Input.Ebv[0])
+
+	log.Infof("Number of realizations: %v", nReal)
+	log.Infof("Number of rows: %v", nData)
+
+	excluded, included, e := ctx.Constraints.regions(&ctx.Input.Grid)
+
+	if e != nil {
+		return nil, nil, nil, e
+	}
+
+	log.Info("Begin creating naive mask")
+	mask := ctx.generateMask()
+
+	// The precedence of the included blocks is needed to include those
+	// above them
+	for i, v := range included {
+		if v {
+			mask[i] = true
+		}
+	}
+
+	log.Info("Begin creating precedence")
+	if e := ctx.Precedence.init(ctx, mask); e != nil {
+		return nil, nil, nil, e
+	} else if e = cx.Err(); e != nil {
+		return nil, nil, nil, e
+	}
+
+	//--------------------------------------------------
+
+	log.Info("Updating mask")
+	for i := 0; i < nData; i++ {
+		if mask[i] {
+			if key := ctx.Precedence.keys[i]; key != MISSING {
+				for _, off := range ctx.Precedence.defs[key] {
+					mask[i+off] = true
+				}
+			}
+		}
+	}
+
+	ctx.stripAir(mask)
+
+	if excluded != nil || included != nil {
+		log.Info("Applying the constraints")
+		if e := ctx.constrain(mask, excluded, included); e != nil {
+			return nil, nil, nil, e
+		}
+	}
+
+	//--------------------------------------------------
+
+	log.Info("Begin compressing")
+
+	var condensedEBV Data
+	var condensedPre Precedence
+
+	if !compressEverything(mask, &ctx.Input, &ctx.Precedence, &condensedEBV, &condensedPre) {
+		e := &SolverError{fmt.Errorf("ERROR: compressing everything failed")}
+		log.Error(e)
+		return nil, nil, nil, e
+	} else if e := cx.Err(); e != nil {
+		return nil, nil, nil, e
+	}
+
+	return mask, &condensedEBV, &condensedPre, nil
+}
+
+// Solve one set of condensed values with a new engine
+func (ctx *Parameters) solve(cx context.Context, ebv []float64, pre *Precedence, p *progress) ([]bool, error) {
+
+	engine, e := getEngine(&ctx.EngineParam)
+
+	if e != nil {
+		log.Errorf("Error: failed initializing optimization engine: %v", e)
+		return nil, e
+	}
+
+	engine.setProgress(p)
+
+	solution, e := engine.computeSolution(cx, ebv, pre)
+
+	return solution, solverError(e)
+}
+
+// Expand condensed solutions to the full grid and add the air blocks
+func (ctx *Parameters) decompress(mask []bool, solutions [][]bool) [][]bool {
+
+	nReal := len(solutions)
+	nData := len(mask)
+
 	selection := make([][]bool, nReal)
 	for i := range selection {
 		selection[i] = make([]bool, nData)
@@ -111,6 +266,15 @@ func (ctx *Parameters) optimizing() ([][]bool, int) {
 		}
 	}
 
+	// Add the included blocks
+	for r := 0; r < nReal; r++ {
+		for i, v := range ctx.included {
+			if v {
+				selection[r][i] = true
+			}
+		}
+	}
+
 	// Fix air blocks
 	log.Info("Fixing air blocks")
 	for r := 0; r < nReal; r++ {
@@ -125,15 +289,20 @@ func (ctx *Parameters) optimizing() ([][]bool, int) {
 		}
 	}
 
-	return selection, 0
+	return selection
 }
 
 func (ctx *Parameters) generateMask() []bool {
 
 	n := ctx.Input.Grid.gridCount()
 	mask := make([]bool, n)
+	air := ctx.Input.air()
 
 	for i := 0; i < n; i++ {
+		// Air above the topography is only needed for the blocks below it
+		if air != nil && air[i] {
+			continue
+		}
 		// If one layer's value is greater than 0,then mask -> true
 		for _, layer := range ctx.Input.Ebv {
 			if len(layer) >= i && layer[i] >= 0 {
@@ -144,23 +313,8 @@ func (ctx *Parameters) generateMask() []bool {
 	}
 
 	// Erase from end until first non zero value (removes air)
-	for i := n - 1; i > 0; i-- {
-
-		air := true
-
-		// If one layer's value is not zero,than the postition is not empty
-		for _, layer := range ctx.Input.Ebv {
-			if len(layer) >= i && layer[i] != 0 {
-				air = false
-				break
-			}
-		}
-
-		if air {
-			mask[i] = false
-		} else {
-			break
-		}
+	for i := ctx.Input.airFrom(); i < n; i++ {
+		mask[i] = false
 	}
 
 	cnt := 0
@@ -0,0 +1,51 @@
+package optimization
+
+import (
+	log "github.com/cihub/seelog"
+)
+
+// The blocks on the bench above: the one directly above and its four
+// neighbours (1:5), or the full 3x3 square (1:9).
+func patternTemplate(square bool) *Template {
+
+	tmpl := new(Template)
+
+	for y := -1; y <= 1; y++ {
+		for x := -1; x <= 1; x++ {
+			if square || x == 0 || y == 0 {
+				tmpl.add(x, y, 1)
+			}
+		}
+	}
+
+	return tmpl
+}
+
+// The classic fixed patterns. The knight's move alternates 1:5 and 1:9 by
+// bench, which over two benches reaches a knight's move away.
+func (this *Precedence) genPattern(ctx *Parameters, mask []bool) {
+
+	pg := &ctx.Input.Grid
+
+	five := patternTemplate(false)
+	nine := patternTemplate(true)
+
+	log.Infof("Number of arcs in templates. 1:5: %v, 1:9: %v", len(five.ixs), len(nine.ixs))
+
+	switch this.Method {
+	case PATTERN_1_5:
+		log.Info("Precedence pattern 1:5")
+		this.applyTemplate(pg, mask, five)
+	case PATTERN_1_9:
+		log.Info("Precedence pattern 1:9")
+		this.applyTemplate(pg, mask, nine)
+	case KNIGHTS_MOVE:
+		log.Info("Precedence pattern knight's move (1:5:9)")
+		this.applyTemplates(pg, mask, func(loc int) *Template {
+			if pg.gridIz(loc)%2 == 0 {
+				return five
+			}
+			return nine
+		})
+	}
+}
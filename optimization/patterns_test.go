@@ -0,0 +1,78 @@
+package optimization
+
+import (
+	"sort"
+	"testing"
+)
+
+// The predecessors of block k, as the offsets to them in ascending order
+func predecessors(pre *Precedence, k int) []int {
+
+	var offsets []int
+
+	if key := pre.keys[k]; key != MISSING {
+		offsets = append(offsets, pre.defs[key]...)
+	}
+
+	sort.Ints(offsets)
+
+	return offsets
+}
+
+func TestPatterns(t *testing.T) {
+
+	grid := Grid{NumX: 3, NumY: 3, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}
+
+	centre := grid.gridIndex(1, 1, 0)
+	corner := grid.gridIndex(0, 0, 0)
+	above := grid.gridIndex(1, 1, 1)
+
+	five := []int{6, 8, 9, 10, 12}
+	nine := []int{5, 6, 7, 8, 9, 10, 11, 12, 13}
+
+	tests := []struct {
+		method int
+		block  int
+		want   []int
+	}{
+		{PATTERN_1_5, centre, five},
+		{PATTERN_1_5, corner, []int{9, 10, 12}},
+		{PATTERN_1_9, centre, nine},
+		{PATTERN_1_9, corner, []int{9, 10, 12, 13}},
+		{KNIGHTS_MOVE, centre, five},
+		{KNIGHTS_MOVE, above, nine},
+	}
+
+	for _, test := range tests {
+
+		ctx := &Parameters{Input: Data{Grid: grid}, Precedence: Precedence{Method: test.method}}
+
+		mask := make([]bool, grid.gridCount())
+		for i := range mask {
+			mask[i] = true
+		}
+
+		if e := ctx.Precedence.init(ctx, mask); e != nil {
+			t.Fatal(e)
+		}
+
+		got := predecessors(&ctx.Precedence, test.block)
+
+		if len(got) != len(test.want) {
+			t.Errorf("method %v block %v: offsets %v, want %v", test.method, test.block, got, test.want)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("method %v block %v: offsets %v, want %v", test.method, test.block, got, test.want)
+				break
+			}
+		}
+
+		// The top bench needs nothing
+		if got := predecessors(&ctx.Precedence, grid.gridIndex(1, 1, 2)); len(got) != 0 {
+			t.Errorf("method %v: top block needs %v", test.method, got)
+		}
+	}
+}
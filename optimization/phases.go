@@ -0,0 +1,334 @@
+package optimization
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// Pushbacks grouped from the nested shells. Shells are added to a phase
+	// until it holds the target tonnage, Tonnage or else the total over Count.
+	// No more than Count phases are made if it is given. A phase must then be
+	// MinWidth wide on every bench beyond the walls of the phases before it,
+	// the blocks in no window that wide being mined in the next phase instead.
+	// The tonnes and ore of the blocks are those of the schedule.
+	PhaseParam struct {
+		Count    int     `json:"count"`
+		Tonnage  float64 `json:"tonnage"`
+		MinWidth float64 `json:"min_width"`
+	}
+)
+
+// True if phases were requested
+func (this *PhaseParam) enabled() bool {
+	return this.Count > 0 || this.Tonnage > 0
+}
+
+func (this *PhaseParam) check() error {
+	if this.Count < 0 {
+		return fmt.Errorf("ERROR: phase count must not be negative. Supplied: %v", this.Count)
+	} else if this.Tonnage < 0 {
+		return fmt.Errorf("ERROR: phase tonnage must not be negative. Supplied: %v", this.Tonnage)
+	} else if this.MinWidth < 0 {
+		return fmt.Errorf("ERROR: minimum width must not be negative. Supplied: %v", this.MinWidth)
+	}
+	return nil
+}
+
+// Solve the shells and group them into phases. The result holds, for each
+// realization and block, the 1 indexed phase the block is mined in, or 0 if
+// it is never mined.
+func (ctx *Parameters) optimizingPhases(cx context.Context) ([][]int, error) {
+
+	e := ctx.Phases.check()
+
+	if e == nil && !ctx.Shells.enabled() {
+		e = fmt.Errorf("ERROR: phases need shells, supply the revenue factors")
+	}
+
+	if e != nil {
+		log.Error(e)
+		return nil, &ParameterError{e}
+	}
+
+	shells, e := ctx.optimizingShells(cx)
+
+	if e != nil {
+		return nil, e
+	}
+
+	phases := make([][]int, len(shells))
+
+	for r, shell := range shells {
+
+		if e := cx.Err(); e != nil {
+			return nil, e
+		}
+
+		tonnes, ore := ctx.blockTonnage(r, ctx.Input.Ebv[r])
+
+		phases[r] = ctx.groupShells(shell, tonnes)
+		ctx.widenPhases(phases[r])
+
+		ctx.logPhases(r, phases[r], tonnes, ore)
+	}
+
+	return phases, nil
+}
+
+// The phase of each block, grouping the shells by the tonnes of the blocks
+func (ctx *Parameters) groupShells(shell []int, tonnes []float64) []int {
+
+	nf := len(ctx.Shells.RevenueFactors)
+
+	increment := make([]float64, nf+1)
+	var total float64
+
+	for i, k := range shell {
+		if k > 0 {
+			increment[k] += tonnes[i]
+			total += tonnes[i]
+		}
+	}
+
+	target := ctx.Phases.Tonnage
+	if target <= 0 {
+		target = total / float64(ctx.Phases.Count)
+	}
+
+	// The phase of each shell
+	phaseOf := make([]int, nf+1)
+	phase := 1
+	var tonnage float64
+
+	for k := 1; k <= nf; k++ {
+
+		phaseOf[k] = phase
+		tonnage += increment[k]
+
+		full := tonnage > 0 && tonnage >= target
+		if full && k < nf && (ctx.Phases.Count <= 0 || phase < ctx.Phases.Count) {
+			phase++
+			tonnage = 0
+		}
+	}
+
+	phases := make([]int, len(shell))
+	for i, k := range shell {
+		phases[i] = phaseOf[k]
+	}
+
+	return phases
+}
+
+// Merge the blocks of each phase that are narrower than the minimum width
+// into the next phase, where it is mined below them and no block left in
+// the phase needs them. A block moves one phase at most, so the narrow
+// bottom benches of a phase stay in it. Phases left empty are dropped.
+func (ctx *Parameters) widenPhases(phases []int) {
+
+	width := ctx.Phases.MinWidth
+
+	if width <= 0 {
+		return
+	}
+
+	g := &ctx.Input.Grid
+	nx, ny := g.NumX, g.NumY
+	bench := nx * ny
+
+	// The width in blocks
+	wx := int(math.Max(1, math.Ceil(width/g.SizX-1e-9)))
+	wy := int(math.Max(1, math.Ceil(width/g.SizY-1e-9)))
+
+	last := 0
+	for _, p := range phases {
+		if p > last {
+			last = p
+		}
+	}
+
+	original := append([]int(nil), phases...)
+	ring := make([]bool, bench)
+	below := make([]bool, bench)
+	need := make([]int, len(phases))
+
+	for p := 1; p < last; p++ {
+
+		// The blocks up to the phase that need each block
+		for i := range need {
+			need[i] = 0
+		}
+		for i, q := range phases {
+			if q > 0 && q <= p {
+				if key := ctx.Precedence.keys[i]; key != MISSING {
+					for _, off := range ctx.Precedence.defs[key] {
+						need[i+off]++
+					}
+				}
+			}
+		}
+
+		for c := range below {
+			below[c] = false
+		}
+
+		// From the bottom up, so the blocks below are settled first
+		for iz := 0; iz < g.NumZ; iz++ {
+
+			base := iz * bench
+
+			for c := range ring {
+				ring[c] = phases[base+c] == p
+			}
+
+			for c, covered := range coverWindows(ring, nx, ny, wx, wy) {
+
+				i := base + c
+
+				if ring[c] && !covered && original[i] == p && below[c] && need[i] == 0 {
+					phases[i] = p + 1
+					if key := ctx.Precedence.keys[i]; key != MISSING {
+						for _, off := range ctx.Precedence.defs[key] {
+							need[i+off]--
+						}
+					}
+				}
+
+				if original[i] == p+1 {
+					below[c] = true
+				}
+			}
+		}
+	}
+
+	var moved int
+	for i, p := range phases {
+		if p != original[i] {
+			moved++
+		}
+	}
+
+	log.Infof("Moved %v blocks to later phases for the minimum width of %v (%v by %v blocks)", moved, width, wx, wy)
+
+	// Renumber the phases that are left
+	count := make([]int, last+1)
+	for _, p := range phases {
+		count[p]++
+	}
+
+	number := make([]int, last+1)
+	next := 0
+	for p := 1; p <= last; p++ {
+		if count[p] > 0 {
+			next++
+		}
+		number[p] = next
+	}
+
+	if dropped := last - next; dropped > 0 {
+		log.Warnf("%v of %v phases are narrower than the minimum width of %v and were merged into the next", dropped, last, width)
+	}
+
+	for i, p := range phases {
+		phases[i] = number[p]
+	}
+}
+
+// The cells of the nx by ny bench in a window of wx by wy cells that are all
+// set
+func coverWindows(set []bool, nx, ny, wx, wy int) []bool {
+
+	// The number set below and left of each corner
+	sum := make([]int, (nx+1)*(ny+1))
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			v := 0
+			if set[x+y*nx] {
+				v = 1
+			}
+			sum[(x+1)+(y+1)*(nx+1)] = v + sum[x+(y+1)*(nx+1)] + sum[(x+1)+y*(nx+1)] - sum[x+y*(nx+1)]
+		}
+	}
+
+	// Mark the full windows at their corners, then sum them over the cells
+	marks := make([]int, (nx+1)*(ny+1))
+	for y := 0; y+wy <= ny; y++ {
+		for x := 0; x+wx <= nx; x++ {
+			n := sum[(x+wx)+(y+wy)*(nx+1)] - sum[x+(y+wy)*(nx+1)] - sum[(x+wx)+y*(nx+1)] + sum[x+y*(nx+1)]
+			if n == wx*wy {
+				marks[x+y*(nx+1)]++
+				marks[(x+wx)+y*(nx+1)]--
+				marks[x+(y+wy)*(nx+1)]--
+				marks[(x+wx)+(y+wy)*(nx+1)]++
+			}
+		}
+	}
+
+	covered := make([]bool, nx*ny)
+	cover := make([]int, (nx+1)*(ny+1))
+
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			k := x + y*(nx+1)
+			cover[k] = marks[k]
+			if x > 0 {
+				cover[k] += cover[k-1]
+			}
+			if y > 0 {
+				cover[k] += cover[k-(nx+1)]
+			}
+			if x > 0 && y > 0 {
+				cover[k] -= cover[k-(nx+1)-1]
+			}
+			covered[x+y*nx] = cover[k] > 0
+		}
+	}
+
+	return covered
+}
+
+// Log the tonnage, value and strip ratio of every phase
+func (ctx *Parameters) logPhases(r int, phases []int, tonnes []float64, ore []bool) {
+
+	last := 0
+	for _, p := range phases {
+		if p > last {
+			last = p
+		}
+	}
+
+	milled := make([]float64, last+1)
+	waste := make([]float64, last+1)
+	values := make([]float64, last+1)
+
+	for i, p := range phases {
+		if p > 0 {
+			if ore[i] {
+				milled[p] += tonnes[i]
+			} else {
+				waste[p] += tonnes[i]
+			}
+			values[p] += ctx.Input.Ebv[r][i]
+		}
+	}
+
+	log.Infof("Phases for realization %3v", r)
+
+	for p := 1; p <= last; p++ {
+
+		// A phase of waste only has no strip ratio
+		ratio := "-"
+		if milled[p] > 0 {
+			ratio = fmt.Sprintf("%.3f", waste[p]/milled[p])
+		}
+
+		log.Infof(
+			"  Phase %3v. Tonnage: %-14.1f Ore: %-14.1f Waste: %-14.1f Strip ratio: %-8v EBV: %f",
+			p, milled[p]+waste[p], milled[p], waste[p], ratio, values[p],
+		)
+	}
+}
@@ -0,0 +1,134 @@
+package optimization
+
+import (
+	"testing"
+)
+
+// Parameters for phases of a grid nx blocks long, one wide and nz deep, of
+// blocks 10 by 20 by 1 without precedence
+func phaseTestParams(nx, nz int, phases PhaseParam, factors int) *Parameters {
+
+	ctx := &Parameters{
+		Input:  Data{Grid: Grid{NumX: nx, NumY: 1, NumZ: nz, SizX: 10, SizY: 20, SizZ: 1}},
+		Shells: ShellParam{RevenueFactors: make([]float64, factors)},
+		Phases: phases,
+	}
+
+	ctx.Precedence.keys = make([]int, nx*nz)
+	for i := range ctx.Precedence.keys {
+		ctx.Precedence.keys[i] = MISSING
+	}
+
+	return ctx
+}
+
+func TestCoverWindows(t *testing.T) {
+
+	// A 5 by 3 bench, the windows are 2 by 2
+	set := []bool{
+		true, true, false, true, true,
+		true, true, true, true, false,
+		false, true, true, false, true,
+	}
+
+	want := []bool{
+		true, true, false, false, false,
+		true, true, true, false, false,
+		false, true, true, false, false,
+	}
+
+	got := coverWindows(set, 5, 3, 2, 2)
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("covered %v, want %v", got, want)
+		}
+	}
+
+	// A window as large as the bench
+	if got := coverWindows([]bool{true, true, true, true}, 2, 2, 2, 2); !got[0] || !got[3] {
+		t.Errorf("covered %v, want all", got)
+	}
+
+	if got := coverWindows([]bool{true, true}, 2, 1, 3, 1); got[0] || got[1] {
+		t.Errorf("covered %v by a window wider than the bench", got)
+	}
+}
+
+// Shells are added to a phase until it holds the target tonnage
+func TestGroupShells(t *testing.T) {
+
+	shell := []int{1, 1, 2, 3, 3, 3, 4, 0}
+
+	tonnes := make([]float64, len(shell))
+	for i := range tonnes {
+		tonnes[i] = 200
+	}
+
+	tests := []struct {
+		phases PhaseParam
+		want   []int
+	}{
+		// 1400 tonnes, the first phase is full at 700 with the third shell
+		{PhaseParam{Count: 2}, []int{1, 1, 1, 1, 1, 1, 2, 0}},
+		{PhaseParam{Tonnage: 400}, []int{1, 1, 2, 2, 2, 2, 3, 0}},
+		// No more than the count
+		{PhaseParam{Count: 2, Tonnage: 400}, []int{1, 1, 2, 2, 2, 2, 2, 0}},
+	}
+
+	for _, test := range tests {
+
+		ctx := phaseTestParams(8, 1, test.phases, 4)
+		got := ctx.groupShells(shell, tonnes)
+
+		for i := range test.want {
+			if got[i] != test.want[i] {
+				t.Errorf("%+v: got %v, want %v", test.phases, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+// A phase narrower than the minimum width on a bench is mined with the next
+func TestWidenPhases(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		nz     int
+		above  bool  // each block needs the one above it
+		phases []int // from the bottom bench up
+		want   []int
+	}{
+		{"wide", 2, false, []int{2, 2, 2, 2, 1, 1, 2, 2}, []int{2, 2, 2, 2, 1, 1, 2, 2}},
+		{"narrow", 2, false, []int{2, 2, 2, 2, 1, 2, 2, 2}, []int{1, 1, 1, 1, 1, 1, 1, 1}},
+		// Nothing of the next phase below, the bottom bench stays
+		{"bottom", 2, false, []int{1, 0, 0, 0, 1, 1, 2, 2}, []int{1, 0, 0, 0, 1, 1, 2, 2}},
+		// The block below in the same phase needs the narrow one
+		{"needed", 2, true, []int{1, 1, 2, 2, 1, 2, 2, 2}, []int{1, 1, 2, 2, 1, 2, 2, 2}},
+		// Each block moves one phase at most, not down the cascade
+		{"one phase", 3, true, []int{3, 3, 3, 3, 2, 3, 3, 3, 1, 2, 3, 3}, []int{2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 2, 2}},
+	}
+
+	for _, test := range tests {
+
+		ctx := phaseTestParams(4, test.nz, PhaseParam{Count: 3, MinWidth: 20}, 3)
+
+		if test.above {
+			ctx.Precedence.defs = [][]int{{4}}
+			for i := 0; i < 4*(test.nz-1); i++ {
+				ctx.Precedence.keys[i] = 0
+			}
+		}
+
+		phases := append([]int(nil), test.phases...)
+		ctx.widenPhases(phases)
+
+		for i := range test.want {
+			if phases[i] != test.want[i] {
+				t.Errorf("%v: got %v, want %v", test.name, phases, test.want)
+				break
+			}
+		}
+	}
+}
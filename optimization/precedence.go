@@ -1,6 +1,7 @@
 package optimization
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 
@@ -9,62 +10,150 @@ import (
 
 type (
 	Precedence struct {
-		Method     int     `json:"method"`
-		Slope      float64 `json:"slope"`
-		NumBenches int     `json:"num_benches"`
+		Method     int       `json:"method"`
+		Slope      float64   `json:"slope"`
+		NumBenches int       `json:"num_benches"`
+		Sectors    Sectors   `json:"sectors"`
+		Zones      ZoneParam `json:"zones"`
 		//-------------------------------------
-		keys []int
-		defs [][]int
+		keys  []int
+		defs  [][]int
+		index map[string]int
+	}
+
+	// The x, y and z block offsets of a precedence template
+	Template struct {
+		ixs, iys, izs []int
 	}
 )
 
 const (
-	BENCH       = 1
-	MISSING     = -1
-	MIN_BENCHES = 1
-	MAX_BENCHES = 15
-	MIN_SLOPE   = 10.0
-	MAX_SLOPE   = 80.0
+	BENCH        = 1
+	SECTORS      = 2
+	ZONES        = 3
+	PATTERN_1_5  = 4
+	PATTERN_1_9  = 5
+	KNIGHTS_MOVE = 6
+	MISSING      = -1
+	MIN_BENCHES  = 1
+	MAX_BENCHES  = 15
+	MIN_SLOPE    = 10.0
+	MAX_SLOPE    = 80.0
 )
 
 func (this *Precedence) init(ctx *Parameters, mask []bool) error {
 
 	var e error
 
-	if this.Method != BENCH {
-		e = fmt.Errorf("Invalid Precedence method")
-	} else if this.NumBenches < MIN_BENCHES || this.NumBenches > MAX_BENCHES {
-		e = fmt.Errorf(
-			"ERROR: benches must be between %v and %v. Supplied: %v",
-			MIN_BENCHES, MAX_BENCHES, this.NumBenches,
-		)
-	} else if this.Slope < MIN_SLOPE || this.Slope > MAX_SLOPE {
-		e = fmt.Errorf(
-			"ERROR: slope must be between %v and %v. Supplied: %v",
-			MIN_SLOPE, MAX_SLOPE, this.Slope,
-		)
+	switch this.Method {
+	case BENCH:
+		if e = checkSlope(this.Slope); e == nil {
+			e = this.checkBenches()
+		}
+	case SECTORS:
+		if e = this.checkSectors(); e == nil {
+			e = this.checkBenches()
+		}
+	case ZONES:
+		if e = this.Zones.check(); e == nil {
+			e = this.checkBenches()
+		}
+	case PATTERN_1_5, PATTERN_1_9, KNIGHTS_MOVE:
+		// Fixed patterns, neither slope nor benches
+	default:
+		e = fmt.Errorf("ERROR: invalid precedence method: %v", this.Method)
+	}
+
+	if e != nil {
+		e = &ParameterError{e}
 	} else if len(mask) != ctx.Input.Grid.gridCount() {
-		e = fmt.Errorf("ERROR: mask size does not equal grid size")
+		e = &InputError{fmt.Errorf("ERROR: mask size does not equal grid size")}
 	}
 
 	if e != nil {
 		log.Error(e)
 		return e
-	} else {
+	}
+
+	switch this.Method {
+	case BENCH:
 		this.genBench(ctx, mask)
-		this.logExtraInfo()
-		return nil
+	case SECTORS:
+		this.genSectors(ctx, mask)
+	case ZONES:
+		e = this.genZones(ctx, mask)
+	case PATTERN_1_5, PATTERN_1_9, KNIGHTS_MOVE:
+		this.genPattern(ctx, mask)
 	}
+
+	if e != nil {
+		log.Error(e)
+		return inputError(e)
+	}
+
+	this.logExtraInfo()
+
+	return nil
+}
+
+func (this *Precedence) checkBenches() error {
+	if this.NumBenches < MIN_BENCHES || this.NumBenches > MAX_BENCHES {
+		return fmt.Errorf(
+			"ERROR: benches must be between %v and %v. Supplied: %v",
+			MIN_BENCHES, MAX_BENCHES, this.NumBenches,
+		)
+	}
+	return nil
+}
+
+func checkSlope(slope float64) error {
+	if slope < MIN_SLOPE || slope > MAX_SLOPE {
+		return fmt.Errorf(
+			"ERROR: slope must be between %v and %v. Supplied: %v",
+			MIN_SLOPE, MAX_SLOPE, slope,
+		)
+	}
+	return nil
 }
 
 func (this *Precedence) genBench(ctx *Parameters, mask []bool) {
 
 	pg := &ctx.Input.Grid
 
-	theta := this.Slope * math.Pi / 180.0
+	tmpl := this.benchTemplate(pg, this.Slope)
+
+	this.applyTemplate(pg, mask, tmpl)
+}
+
+// A circular cone of the given slope
+func (this *Precedence) benchTemplate(pg *Grid, slope float64) *Template {
+
+	theta := slope * math.Pi / 180.0
 	maxVert := float64(this.NumBenches) * pg.SizZ
 	maxRadius := maxVert / math.Tan(theta)
 
+	return this.genTemplate(pg, maxRadius, benchCone(slope))
+}
+
+// True if the offset is inside the exact cone of the given slope
+func benchCone(slope float64) func(xloc, yloc, zloc float64) bool {
+
+	theta := slope * math.Pi / 180.0
+
+	return func(xloc, yloc, zloc float64) bool {
+		rad := zloc / math.Tan(theta)
+		return xloc*xloc+yloc*yloc <= rad*rad
+	}
+}
+
+// Generate the offsets of a template reaching maxRadius, with each bench
+// holding the blocks that inside accepts, less those of the bench below.
+func (this *Precedence) genTemplate(
+	pg *Grid,
+	maxRadius float64,
+	inside func(xloc, yloc, zloc float64) bool,
+) *Template {
+
 	xblock := int(maxRadius / pg.SizX)
 	yblock := int(maxRadius / pg.SizY)
 
@@ -88,24 +177,20 @@ func (this *Precedence) genBench(ctx *Parameters, mask []bool) {
 	for z := 0; z < zblocks; z++ {
 
 		zloc := float64(z+1) * pg.SizZ
-		rad := zloc / math.Tan(theta)
-		rad2 := rad * rad
 
 		dimy := make([][]bool, yblocks)
 
 		for y := 0; y < yblocks; y++ {
 
 			yloc := float64(y-ycenter) * pg.SizY
-			yloc2 := yloc * yloc
 
 			dimx := make([]bool, xblocks)
 
 			for x := 0; x < xblocks; x++ {
 
 				xloc := float64(x-xcenter) * pg.SizX
-				xloc2 := xloc * xloc
 
-				dimx[x] = (xloc2+yloc2 <= rad2)
+				dimx[x] = inside(xloc, yloc, zloc)
 			}
 
 			dimy[y] = dimx
@@ -134,7 +219,7 @@ func (this *Precedence) genBench(ctx *Parameters, mask []bool) {
 
 	//---------------------------------------------------------------------------
 
-	var firstDef, ixs, iys, izs []int
+	tmpl := new(Template)
 
 	for z := 0; z < zblocks; z++ {
 		zl := z + 1
@@ -143,16 +228,31 @@ func (this *Precedence) genBench(ctx *Parameters, mask []bool) {
 			for x := 0; x < xblocks; x++ {
 				xl := x - xblock
 				if offTemplate[z][y][x] {
-					n := pg.gridIndex(xl, yl, zl)
-					firstDef = append(firstDef, n)
-					ixs = append(ixs, xl)
-					iys = append(iys, yl)
-					izs = append(izs, zl)
+					tmpl.add(xl, yl, zl)
 				}
 			}
 		}
 	}
 
+	return tmpl
+}
+
+// Give every masked block (and everything they reach) the template offsets
+// that stay inside the grid.
+func (this *Precedence) applyTemplate(pg *Grid, mask []bool, tmpl *Template) {
+	this.applyTemplates(pg, mask, func(loc int) *Template { return tmpl })
+}
+
+// As applyTemplate, but with the template chosen for each block
+func (this *Precedence) applyTemplates(pg *Grid, mask []bool, choose func(loc int) *Template) {
+
+	var firstDef []int
+
+	first := choose(0)
+	for i := range first.ixs {
+		firstDef = append(firstDef, pg.gridIndex(first.ixs[i], first.iys[i], first.izs[i]))
+	}
+
 	this.addToDefs(firstDef)
 
 	//---------------------------------------------------------------------------
@@ -178,14 +278,16 @@ func (this *Precedence) genBench(ctx *Parameters, mask []bool) {
 
 				var thisdef []int
 
-				for i := range ixs {
+				tmpl := choose(loc)
 
-					xl := x + ixs[i]
-					yl := y + iys[i]
-					zl := z + izs[i]
+				for i := range tmpl.ixs {
+
+					xl := x + tmpl.ixs[i]
+					yl := y + tmpl.iys[i]
+					zl := z + tmpl.izs[i]
 
 					if in(xl, pg.NumX) && in(yl, pg.NumY) && in(zl, pg.NumZ) {
-						ind := pg.gridIndex(ixs[i], iys[i], izs[i])
+						ind := pg.gridIndex(tmpl.ixs[i], tmpl.iys[i], tmpl.izs[i])
 						thisdef = append(thisdef, ind)
 						hit[loc+ind] = true
 					}
@@ -204,28 +306,25 @@ func (this *Precedence) genBench(ctx *Parameters, mask []bool) {
 // Try to add the given definition to the defs, return the key
 func (this *Precedence) addToDefs(defs []int) int {
 
-	// Check for duplicates
-	for idx, array := range this.defs {
-
-		if len(array) != len(defs) {
-			continue
-		}
+	if this.index == nil {
+		this.index = make(map[string]int)
+	}
 
-		same := true
+	// Check for duplicates
+	var buf [binary.MaxVarintLen64]byte
+	key := make([]byte, 0, len(defs)*2)
 
-		for i := range array {
-			if array[i] != defs[i] {
-				same = false
-				break
-			}
-		}
+	for _, v := range defs {
+		n := binary.PutVarint(buf[:], int64(v))
+		key = append(key, buf[:n]...)
+	}
 
-		if same {
-			return idx
-		}
+	if idx, ok := this.index[string(key)]; ok {
+		return idx
 	}
 
 	this.defs = append(this.defs, defs)
+	this.index[string(key)] = len(this.defs) - 1
 
 	return len(this.defs) - 1
 }
@@ -263,3 +362,9 @@ func (this *Precedence) logExtraInfo() {
 
 	log.Infof("Number of uncompressed arcs: %v", arcCount)
 }
+
+func (this *Template) add(ix, iy, iz int) {
+	this.ixs = append(this.ixs, ix)
+	this.iys = append(this.iys, iy)
+	this.izs = append(this.izs, iz)
+}
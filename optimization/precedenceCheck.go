@@ -0,0 +1,406 @@
+package optimization
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	PrecedenceCheckParams struct {
+		ParamFile string
+		Depth     int     // The deepest level checked, in benches
+		Tolerance float64 // Error (in percent) allowed above the best bench count
+	}
+
+	// A template and the exact cone it approximates
+	coneCheck struct {
+		name      string
+		cone      func(xloc, yloc, zloc float64) bool
+		template  func(benches int) *Template
+		alternate *Template // Used on every other level, if any
+		variable  bool      // True if the template depends on the number of benches
+	}
+
+	// The blocks of one level of the exact cone against the template closure
+	levelCheck struct {
+		exact, reached, missed, extra int
+	}
+)
+
+const (
+	DEFAULT_CHECK_DEPTH     = 2 * MAX_BENCHES
+	DEFAULT_CHECK_TOLERANCE = 1.0
+	CHECK_PATIENCE          = 4 // Bench counts tried past the best error
+)
+
+// Report how well the precedence of the parameter file reproduces the exact
+// slope. The templates are chained together, as the solvers do, and every
+// level beyond the template is compared with the exact cone.
+func CheckPrecedence(opt PrecedenceCheckParams, w io.Writer) error {
+
+	var params Parameters
+
+	if e := readJsonFile(opt.ParamFile, &params); e != nil {
+		return &ParameterError{e}
+	}
+
+	if opt.Depth <= 0 {
+		opt.Depth = DEFAULT_CHECK_DEPTH
+	}
+
+	if opt.Tolerance <= 0 {
+		opt.Tolerance = DEFAULT_CHECK_TOLERANCE
+	}
+
+	pre := &params.Precedence
+	pg := &params.Input.Grid
+
+	cones, e := pre.cones(pg)
+
+	if e != nil {
+		log.Error(e)
+		return &ParameterError{e}
+	}
+
+	fmt.Fprintln(w, pg.String())
+
+	for _, c := range cones {
+
+		tmpls := c.templates(pre.NumBenches)
+
+		fmt.Fprintf(w, "\n%v, %v arcs per block\n", c.name, len(tmpls[0].ixs))
+		fmt.Fprintf(w, "%8v %10v %10v %10v %10v %10v\n", "Level", "Exact", "Reached", "Missed", "Extra", "Error %")
+
+		checks := closureCheck(pg, tmpls, c.cone, opt.Depth)
+
+		first := 1
+		if c.variable {
+			first = pre.NumBenches + 1
+		}
+
+		for z := first; z <= opt.Depth; z++ {
+			lc := checks[z]
+			fmt.Fprintf(w, "%8v %10v %10v %10v %10v %10.2f\n",
+				z, lc.exact, lc.reached, lc.missed, lc.extra, lc.errorPercent())
+		}
+
+		if c.variable {
+			recommendBenches(w, pg, c, opt)
+		}
+	}
+
+	return nil
+}
+
+// The templates of the precedence method and their exact cones
+func (this *Precedence) cones(pg *Grid) ([]coneCheck, error) {
+
+	// The templates are built with other bench counts
+	withBenches := func(benches int) *Precedence {
+		other := *this
+		other.NumBenches = benches
+		return &other
+	}
+
+	switch this.Method {
+	case BENCH:
+		if e := checkSlope(this.Slope); e != nil {
+			return nil, e
+		}
+		return []coneCheck{{
+			name:     fmt.Sprintf("Bench cone, slope %v", this.Slope),
+			cone:     benchCone(this.Slope),
+			template: func(b int) *Template { return withBenches(b).benchTemplate(pg, this.Slope) },
+			variable: true,
+		}}, nil
+
+	case SECTORS:
+		if e := this.checkSectors(); e != nil {
+			return nil, e
+		}
+		return []coneCheck{{
+			name:     fmt.Sprintf("Slope sectors, %v", len(this.Sectors)),
+			cone:     this.Sectors.sorted().cone(),
+			template: func(b int) *Template { return withBenches(b).sectorTemplate(pg, this.Sectors) },
+			variable: true,
+		}}, nil
+
+	case ZONES:
+		if e := this.Zones.check(); e != nil {
+			return nil, e
+		}
+
+		var cones []coneCheck
+
+		for _, z := range this.Zones.Slopes {
+			z := z
+			if len(z.Sectors) > 0 {
+				cones = append(cones, coneCheck{
+					name:     fmt.Sprintf("Zone %v, slope sectors, %v", z.Code, len(z.Sectors)),
+					cone:     z.Sectors.sorted().cone(),
+					template: func(b int) *Template { return withBenches(b).sectorTemplate(pg, z.Sectors) },
+					variable: true,
+				})
+			} else {
+				cones = append(cones, coneCheck{
+					name:     fmt.Sprintf("Zone %v, slope %v", z.Code, z.Slope),
+					cone:     benchCone(z.Slope),
+					template: func(b int) *Template { return withBenches(b).benchTemplate(pg, z.Slope) },
+					variable: true,
+				})
+			}
+		}
+
+		return cones, nil
+
+	case PATTERN_1_5, PATTERN_1_9, KNIGHTS_MOVE:
+		if e := checkSlope(this.Slope); e != nil {
+			return nil, fmt.Errorf("%v (the slope the pattern is compared with)", e)
+		}
+
+		c := coneCheck{cone: benchCone(this.Slope)}
+
+		switch this.Method {
+		case PATTERN_1_5:
+			c.name = "Pattern 1:5"
+			c.template = func(int) *Template { return patternTemplate(false) }
+		case PATTERN_1_9:
+			c.name = "Pattern 1:9"
+			c.template = func(int) *Template { return patternTemplate(true) }
+		default:
+			c.name = "Pattern knight's move"
+			c.template = func(int) *Template { return patternTemplate(false) }
+			c.alternate = patternTemplate(true)
+		}
+
+		c.name += fmt.Sprintf(", slope %v", this.Slope)
+
+		return []coneCheck{c}, nil
+
+	default:
+		return nil, fmt.Errorf("ERROR: invalid precedence method: %v", this.Method)
+	}
+}
+
+// The templates used by the levels, in turn
+func (this *coneCheck) templates(benches int) []*Template {
+	if this.alternate != nil {
+		return []*Template{this.template(benches), this.alternate}
+	}
+	return []*Template{this.template(benches)}
+}
+
+// Chain the templates from one block up to depth levels, and compare each
+// level with the exact cone. Level z uses tmpls[z % len(tmpls)].
+func closureCheck(pg *Grid, tmpls []*Template, cone func(xloc, yloc, zloc float64) bool, depth int) []levelCheck {
+
+	// The most blocks an arc reaches out for each level it rises, so the
+	// closure reaches no further than that times the depth
+	var reach float64
+	for _, tmpl := range tmpls {
+		for i := range tmpl.ixs {
+			if tmpl.izs[i] > 0 {
+				out := maxInt(absInt(tmpl.ixs[i]), absInt(tmpl.iys[i]))
+				reach = math.Max(reach, float64(out)/float64(tmpl.izs[i]))
+			}
+		}
+	}
+
+	// Far enough for both the closure and the exact cone
+	minSize := math.Min(pg.SizX, pg.SizY)
+	exactReach := int(float64(depth)*pg.SizZ/math.Tan(MIN_SLOPE*math.Pi/180.0)/minSize) + 1
+	half := maxInt(int(math.Ceil(reach*float64(depth))), exactReach)
+	side := 2*half + 1
+
+	// Each row of each level is a bitset, x in bit x % 64 of word x / 64,
+	// so an arc moves a whole row at once
+	words := (side + 63) / 64
+	spare := ^uint64(0) >> uint(64*words-side) // The bits of the last word inside the side
+
+	levels := make([][][]uint64, depth+1)
+	for z := range levels {
+		levels[z] = make([][]uint64, side)
+		for y := range levels[z] {
+			levels[z][y] = make([]uint64, words)
+		}
+	}
+
+	levels[0][half][half/64] = 1 << uint(half%64)
+
+	for z := 0; z < depth; z++ {
+
+		tmpl := tmpls[z%len(tmpls)]
+
+		for y, row := range levels[z] {
+
+			// Drop what arcs pushed past the side
+			row[words-1] &= spare
+
+			if emptyRow(row) {
+				continue
+			}
+
+			for i := range tmpl.ixs {
+
+				nz := z + tmpl.izs[i]
+				ny := y + tmpl.iys[i]
+
+				if nz <= depth && 0 <= ny && ny < side {
+					orShifted(levels[nz][ny], row, tmpl.ixs[i])
+				}
+			}
+		}
+	}
+
+	checks := make([]levelCheck, depth+1)
+
+	for z := 1; z <= depth; z++ {
+
+		zloc := float64(z) * pg.SizZ
+		lc := &checks[z]
+
+		for y := 0; y < side; y++ {
+
+			yloc := float64(y-half) * pg.SizY
+
+			for x := 0; x < side; x++ {
+
+				xloc := float64(x-half) * pg.SizX
+
+				exact := cone(xloc, yloc, zloc)
+				reached := levels[z][y][x/64]>>uint(x%64)&1 == 1
+
+				if exact {
+					lc.exact++
+				}
+				if reached {
+					lc.reached++
+				}
+				if exact && !reached {
+					lc.missed++
+				}
+				if reached && !exact {
+					lc.extra++
+				}
+			}
+		}
+	}
+
+	return checks
+}
+
+func emptyRow(row []uint64) bool {
+	for _, w := range row {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Set in dst every bit of src moved shift bits up (down if negative). Bits
+// moved below the first are dropped, those past the last word too.
+func orShifted(dst, src []uint64, shift int) {
+
+	n := len(src)
+
+	if shift >= 0 {
+		ws, bs := shift/64, uint(shift%64)
+		for i := n - 1 - ws; i >= 0; i-- {
+			dst[i+ws] |= src[i] << bs
+			if bs > 0 && i+ws+1 < n {
+				dst[i+ws+1] |= src[i] >> (64 - bs)
+			}
+		}
+	} else {
+		ws, bs := -shift/64, uint(-shift%64)
+		for i := ws; i < n; i++ {
+			dst[i-ws] |= src[i] >> bs
+			if bs > 0 && i-ws-1 >= 0 {
+				dst[i-ws-1] |= src[i] << (64 - bs)
+			}
+		}
+	}
+}
+
+func (this levelCheck) errorPercent() float64 {
+	if this.exact == 0 {
+		return 0
+	}
+	return float64(this.missed+this.extra) / float64(this.exact) * 100.0
+}
+
+// Try the bench counts short of the depth and recommend the smallest one
+// whose error at the deepest level is within the tolerance of the best. The
+// counts stop once CHECK_PATIENCE more have not lowered the error.
+func recommendBenches(w io.Writer, pg *Grid, c coneCheck, opt PrecedenceCheckParams) {
+
+	last := minInt(MAX_BENCHES, opt.Depth-1)
+
+	if last < MIN_BENCHES {
+		fmt.Fprintf(w, "No recommendation, the depth must be more than %v benches\n", MIN_BENCHES)
+		return
+	}
+
+	errors := make([]float64, last+1)
+	arcs := make([]int, last+1)
+	best := math.Inf(1)
+
+	fmt.Fprintf(w, "\n%8v %10v %10v\n", "Benches", "Arcs", "Error %")
+
+	bestAt := MIN_BENCHES
+
+	for b := MIN_BENCHES; b <= last; b++ {
+
+		if b-bestAt > CHECK_PATIENCE {
+			fmt.Fprintf(w, "Stopped, %v more benches did not lower the error\n", CHECK_PATIENCE)
+			last = b - 1
+			break
+		}
+
+		tmpls := c.templates(b)
+		checks := closureCheck(pg, tmpls, c.cone, opt.Depth)
+
+		arcs[b] = len(tmpls[0].ixs)
+		errors[b] = checks[opt.Depth].errorPercent()
+
+		if errors[b] < best {
+			best = errors[b]
+			bestAt = b
+		}
+
+		fmt.Fprintf(w, "%8v %10v %10.2f\n", b, arcs[b], errors[b])
+	}
+
+	for b := MIN_BENCHES; b <= last; b++ {
+		if errors[b] <= best+opt.Tolerance {
+			fmt.Fprintf(w, "Recommended benches: %v (%v arcs, %.2f%% error at level %v)\n",
+				b, arcs[b], errors[b], opt.Depth)
+			return
+		}
+	}
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+)
+
+// Chained 1:5 patterns make a diamond, and chained 1:9 patterns a square,
+// so each reproduces a cone of that shape exactly
+func TestClosureCheckExact(t *testing.T) {
+
+	pg := &Grid{NumX: 1, NumY: 1, NumZ: 1, SizX: 10, SizY: 10, SizZ: 10}
+
+	diamond := func(xloc, yloc, zloc float64) bool { return math.Abs(xloc)+math.Abs(yloc) <= zloc }
+	square := func(xloc, yloc, zloc float64) bool { return math.Max(math.Abs(xloc), math.Abs(yloc)) <= zloc }
+
+	for _, test := range []struct {
+		tmpl *Template
+		cone func(xloc, yloc, zloc float64) bool
+		one  int
+	}{
+		{patternTemplate(false), diamond, 5},
+		{patternTemplate(true), square, 9},
+	} {
+
+		checks := closureCheck(pg, []*Template{test.tmpl}, test.cone, 6)
+
+		if checks[1].exact != test.one {
+			t.Errorf("level 1 has %v blocks, want %v", checks[1].exact, test.one)
+		}
+
+		for z := 1; z <= 6; z++ {
+			if lc := checks[z]; lc.missed != 0 || lc.extra != 0 || lc.reached != lc.exact {
+				t.Errorf("level %v: %+v, want an exact match", z, lc)
+			}
+		}
+	}
+}
+
+// A 1:5 pattern misses the corners of a round 45 degree cone, and a 1:9
+// pattern overreaches them
+func TestClosureCheckRound(t *testing.T) {
+
+	pg := &Grid{NumX: 1, NumY: 1, NumZ: 1, SizX: 10, SizY: 10, SizZ: 10}
+
+	round := func(xloc, yloc, zloc float64) bool { return xloc*xloc+yloc*yloc <= zloc*zloc }
+
+	five := closureCheck(pg, []*Template{patternTemplate(false)}, round, 8)[8]
+	nine := closureCheck(pg, []*Template{patternTemplate(true)}, round, 8)[8]
+
+	if five.missed == 0 || five.extra != 0 {
+		t.Errorf("1:5 at level 8: %+v, want only missed blocks", five)
+	}
+
+	if nine.extra == 0 || nine.missed != 0 {
+		t.Errorf("1:9 at level 8: %+v, want only extra blocks", nine)
+	}
+
+	if five.errorPercent() <= 0 || nine.errorPercent() <= 0 {
+		t.Errorf("errors %v and %v, want both positive", five.errorPercent(), nine.errorPercent())
+	}
+}
@@ -0,0 +1,91 @@
+package optimization
+
+import (
+	log "github.com/cihub/seelog"
+)
+
+// The upper bounds of the probability bands in the summary, above 0 and
+// below 1 which are counted on their own
+var probability_bands = []float64{0.25, 0.5, 0.75}
+
+// The fraction of the realizations mining each block. rows has one value
+// per block for each realization, 0 where the block is not mined, as the
+// pits and shells are written.
+func probability(rows [][]int) []float64 {
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	prob := make([]float64, len(rows[0]))
+
+	for _, row := range rows {
+		for i, v := range row {
+			if v != 0 {
+				prob[i]++
+			}
+		}
+	}
+
+	for i := range prob {
+		prob[i] /= float64(len(rows))
+	}
+
+	return prob
+}
+
+// The fraction of the realizations whose pit mines each block. Blocks with
+// 1 are in the guaranteed pit, those above 0 in the possible pit.
+func (this *Result) Probability() []float64 {
+
+	rows := make([][]int, len(this.Pits))
+
+	for r, pit := range this.Pits {
+		rows[r] = make([]int, len(pit.Selected))
+		for i, v := range pit.Selected {
+			if v {
+				rows[r][i] = 1
+			}
+		}
+	}
+
+	return probability(rows)
+}
+
+// Log the number of blocks in each probability band
+func logProbability(prob []float64) {
+
+	counts := make([]int, len(probability_bands)+1)
+	never, guaranteed := 0, 0
+
+	for _, p := range prob {
+		switch {
+		case p == 0:
+			never++
+		case p == 1:
+			guaranteed++
+		default:
+			band := 0
+			for band < len(probability_bands) && p > probability_bands[band] {
+				band++
+			}
+			counts[band]++
+		}
+	}
+
+	log.Info("Probability of mining")
+	log.Infof("  Never            : %v blocks", never)
+
+	lower := 0.0
+	for band, n := range counts {
+		upper := 1.0
+		if band < len(probability_bands) {
+			upper = probability_bands[band]
+		}
+		log.Infof("  %4.2f to %4.2f     : %v blocks", lower, upper, n)
+		lower = upper
+	}
+
+	log.Infof("  Always           : %v blocks", guaranteed)
+	log.Infof("Guaranteed pit: %v blocks, possible pit: %v blocks", guaranteed, len(prob)-never)
+}
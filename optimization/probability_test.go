@@ -0,0 +1,53 @@
+package optimization
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// Shells count as mined whatever their number
+func TestProbability(t *testing.T) {
+
+	rows := [][]int{{1, 0, 2, 0}, {1, 1, 0, 0}, {3, 0, 0, 0}, {1, 0, 1, 0}}
+	want := []float64{1, 0.25, 0.5, 0}
+
+	got := probability(rows)
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	result := &Result{Pits: []Pit{
+		{Selected: []bool{true, false, true}},
+		{Selected: []bool{true, false, false}},
+	}}
+
+	if got := result.Probability(); got[0] != 1 || got[1] != 0 || got[2] != 0.5 {
+		t.Errorf("pits give %v, want [1 0 0.5]", got)
+	}
+}
+
+// The probability is a column beside the value of every realization
+func TestProbabilityOutput(t *testing.T) {
+
+	rows := [][]int{{1, 0}, {1, 1}}
+	table := &outputTable{title: "Pit", rows: rows, prob: probability(rows)}
+
+	param := OutputParam{}
+	param.addColumn("probability", "Pit")
+
+	var buffer bytes.Buffer
+
+	if e := writeOutput(context.Background(), &buffer, &param, true, table); e != nil {
+		t.Fatal(e)
+	}
+
+	want := "ultpit output\n2\npit\nprobability\n1 1\n0 0.5\n1 1\n1 0.5\n"
+
+	if got := buffer.String(); got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
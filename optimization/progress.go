@@ -0,0 +1,206 @@
+package optimization
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// A snapshot of the work of an engine. A solve is one realization, or
+	// one realization and revenue factor for shells.
+	Progress struct {
+		Solve     int           // 1 indexed
+		Solves    int           // Number of solves
+		Stage     string        // What the engine is doing
+		Pass      int64         // LG: passes over the blocks, max flow: phases
+		ArcsAdded int64         // LG: arcs added to the tree
+		Strong    int           // LG: blocks in strong branches
+		Weak      int           // LG: blocks in weak branches
+		Value     float64       // LG: value of the strong blocks, max flow: bound on the pit value
+		Fraction  float64       // Estimated part of the solve done, negative if unknown
+		Elapsed   time.Duration // Since the first solve began
+		Remaining time.Duration // Estimated until every solve is done, negative if unknown
+	}
+
+	ProgressFunc func(Progress)
+
+	// Throttles the reports of the engines, which may run at the same time,
+	// and estimates the time remaining
+	progressReporter struct {
+		report   ProgressFunc
+		interval time.Duration
+		mu       sync.Mutex
+		solves   int
+		workers  int
+		start    time.Time     // of the first solve
+		last     time.Time     // report
+		done     int           // solves finished
+		busy     time.Duration // taken by the solves finished
+	}
+
+	// The progress of one solve
+	progress struct {
+		reporter *progressReporter
+		solve    int
+		begun    time.Time
+	}
+)
+
+// The interval between reports, if none is given
+const DEFAULT_PROGRESS_INTERVAL = 10 * time.Second
+
+func newProgressReporter(report ProgressFunc, interval time.Duration) *progressReporter {
+
+	if report == nil {
+		return nil
+	}
+
+	if interval <= 0 {
+		interval = DEFAULT_PROGRESS_INTERVAL
+	}
+
+	return &progressReporter{report: report, interval: interval}
+}
+
+// Start counting solves, workers of them at once
+func (this *progressReporter) reset(solves, workers int) {
+
+	if this == nil {
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.solves = solves
+	this.workers = workers
+	this.start = time.Now()
+	this.last = this.start
+	this.done = 0
+	this.busy = 0
+}
+
+// Start the 1 indexed solve
+func (this *progressReporter) begin(solve int) *progress {
+
+	if this == nil {
+		return nil
+	}
+
+	return &progress{reporter: this, solve: solve, begun: time.Now()}
+}
+
+func (this *progress) end() {
+
+	if this == nil {
+		return
+	}
+
+	r := this.reporter
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.done++
+	r.busy += time.Since(this.begun)
+}
+
+// True if a report is wanted, engines check this before gathering one
+func (this *progress) due() bool {
+
+	if this == nil {
+		return false
+	}
+
+	r := this.reporter
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return time.Since(r.last) >= r.interval
+}
+
+// Report the stage at every interval until stopped, for the engines that
+// cannot report while they wait.
+func (this *progress) waiting(stage string) (stop func()) {
+
+	if this == nil {
+		return func() {}
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(this.reporter.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if this.due() {
+					this.send(Progress{Stage: stage, Fraction: -1})
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+func (this *progress) send(p Progress) {
+
+	if this == nil {
+		return
+	}
+
+	r := this.reporter
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.last = now
+
+	p.Solve = this.solve
+	p.Solves = r.solves
+	p.Elapsed = now.Sub(r.start)
+	p.Remaining = -1
+
+	// The time of a solve, from this one if the engine knows how far it
+	// is, otherwise from the average of those done
+	var perSolve time.Duration
+	current := now.Sub(this.begun)
+
+	if p.Fraction > 0 {
+		perSolve = time.Duration(float64(current) / p.Fraction)
+	} else if r.done > 0 {
+		perSolve = r.busy / time.Duration(r.done)
+	}
+
+	if perSolve > 0 {
+
+		left := r.solves - r.done
+		parallel := r.workers
+		if parallel > left {
+			parallel = left
+		}
+		if parallel < 1 {
+			parallel = 1
+		}
+
+		p.Remaining = perSolve*time.Duration(left)/time.Duration(parallel) - current
+		if p.Remaining < 0 {
+			p.Remaining = 0
+		}
+	}
+
+	r.report(p)
+}
@@ -0,0 +1,117 @@
+package optimization
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The time remaining is that of the solves done, or of the part of this
+// solve done when the engine knows it
+func TestProgressRemaining(t *testing.T) {
+
+	var got Progress
+	r := newProgressReporter(func(p Progress) { got = p }, time.Second)
+
+	// Two solves of 10s done, one at a time
+	now := time.Now()
+	r.reset(5, 1)
+	r.start = now.Add(-30 * time.Second)
+	r.done = 2
+	r.busy = 20 * time.Second
+
+	p := r.begin(3)
+	p.begun = now.Add(-10 * time.Second)
+
+	tests := []struct {
+		fraction float64
+		want     time.Duration
+	}{
+		// 10s for each of the 3 solves left, 10s of this one gone
+		{-1, 20 * time.Second},
+		// Half done after 10s, 10s to go and 20s for each of 2 more
+		{0.5, 50 * time.Second},
+	}
+
+	for _, test := range tests {
+
+		p.send(Progress{Fraction: test.fraction})
+
+		if got.Solve != 3 || got.Solves != 5 {
+			t.Errorf("solve %v of %v, want 3 of 5", got.Solve, got.Solves)
+		}
+
+		if d := got.Remaining - test.want; d < -time.Second || d > time.Second {
+			t.Errorf("fraction %v: remaining %v, want %v", test.fraction, got.Remaining, test.want)
+		}
+	}
+
+	// Nothing to go by in the first solve
+	r.reset(5, 1)
+	r.begin(1).send(Progress{Fraction: -1})
+
+	if got.Remaining >= 0 {
+		t.Errorf("remaining %v, want unknown", got.Remaining)
+	}
+
+	// Without a report function there is no progress, and it is never due
+	none := newProgressReporter(nil, time.Second)
+	none.reset(1, 1)
+	q := none.begin(1)
+	q.waiting("waiting")()
+	q.end()
+
+	if q.due() {
+		t.Error("progress due without a report function")
+	}
+}
+
+// The engine reports the solve it is on while it works
+func TestProgressReports(t *testing.T) {
+
+	grid := Grid{NumX: 7, NumY: 6, NumZ: 4, SizX: 10, SizY: 10, SizZ: 10}
+	random := rand.New(rand.NewSource(2))
+
+	values := make([][]float64, 2)
+	for r := range values {
+		values[r] = make([]float64, grid.gridCount())
+		for i := range values[r] {
+			values[r][i] = float64(random.Intn(20) - 15)
+		}
+	}
+
+	model, e := NewBlockModel(grid, values...)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	var lock sync.Mutex
+	var reports []Progress
+
+	opt := Options{
+		Precedence: Precedence{Method: BENCH, Slope: 45, NumBenches: 1},
+		Engine:     EngineParam{EngineType: Engine_MAXFLOW},
+		Progress: func(p Progress) {
+			lock.Lock()
+			reports = append(reports, p)
+			lock.Unlock()
+		},
+		ProgressInterval: time.Nanosecond,
+	}
+
+	if _, e := Optimize(model, opt); e != nil {
+		t.Fatal(e)
+	}
+
+	if len(reports) == 0 {
+		t.Fatal("no progress reported")
+	}
+
+	for _, p := range reports {
+		if p.Solve < 1 || p.Solve > 2 || p.Solves != 2 || p.Elapsed < 0 {
+			t.Fatalf("report %+v, want solve 1 or 2 of 2", p)
+		}
+	}
+}
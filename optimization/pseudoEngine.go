@@ -1,19 +1,24 @@
 package optimization
 
 import (
-	"github.com/clbanning/pseudo"
-	"io"
-	"log"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/clbanning/pseudo"
 )
 
 type (
 	PseudoSolver struct {
-		N         struct{} // redundant?
-		A         struct{} // likewise
 		numNodes  uint
 		numArcs   uint
 		Precision float64
+		progress  *progress
 	}
 )
 
@@ -23,44 +28,70 @@ func newPseudoflowEngine(param *EngineParam) (UltpitEngine, error) {
 		Precision: param.Precision,
 	}
 
-	if math.Abs(engine.Precision) < 1e6 {
-		engine.Precision = 100.0
+	if engine.Precision <= 0 {
+		engine.Precision = DEFAULT_PRECISION
 	}
 
-	//if e := engine.init(); e == nil {
 	return engine, nil
-	//} else {
-	//	return nil, e
-	//}
 }
 
-func (p *PseudoSolver) computeSolution(data []float64, pre *Precedence) (solution []bool, r int) {
+func (p *PseudoSolver) setProgress(pr *progress) {
+	p.progress = pr
+}
+
+func (p *PseudoSolver) computeSolution(ctx context.Context, data []float64, pre *Precedence) ([]bool, error) {
 
 	count := len(data)
 
-	solution = make([]bool, count)
-
-	p.sendInput(data, pre)
-	//p.stdin.Close()
-	//
-	//scanner := bufio.NewScanner(p.stdout)
-	//scanner.Split(bufio.ScanLines)
-	//
-	//for scanner.Scan() {
-	//	items := strings.Fields(scanner.Text())
-	//	if len(items) == 2 && items[0] == "n" {
-	//		if n, e := strconv.Atoi(items[1]); e == nil && n != 1 {
-	//			solution[n-2] = true
-	//		}
-	//	}
-	//}
-	//
-	//p.cmd.Wait()
-
-	return
+	solution := make([]bool, count)
+
+	n, a := p.sendInput(data, pre)
+
+	var buf bytes.Buffer
+
+	s := pseudo.NewSession(pseudo.Context{DisplayCut: true})
+
+	// pseudo cannot be stopped, when the context ends first its result is
+	// dropped once it returns
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.RunNAWriter(p.numNodes, p.numArcs, n, a, &buf, "")
+	}()
+
+	stop := p.progress.waiting("running pseudoflow")
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		log.Info("Waiting for pseudoflow to return before stopping")
+		<-done
+		return nil, ctx.Err()
+	case e := <-done:
+		if e != nil {
+			e = fmt.Errorf("ERROR: pseudoflow failed: %v", e)
+			log.Error(e)
+			return nil, e
+		}
+	}
+
+	// The source set of the minimum cut is the pit, the source itself is node 1
+	scanner := bufio.NewScanner(&buf)
+	scanner.Split(bufio.ScanLines)
+
+	for scanner.Scan() {
+		items := strings.Fields(scanner.Text())
+		if len(items) == 2 && items[0] == "n" {
+			if v, e := strconv.Atoi(items[1]); e == nil && v > 1 && v < int(p.numNodes) {
+				solution[v-2] = true
+			}
+		}
+	}
+
+	return solution, nil
 }
 
-func (p *PseudoSolver) sendInput(data []float64, pre *Precedence) {
+func (p *PseudoSolver) sendInput(data []float64, pre *Precedence) ([]pseudo.N, []pseudo.A) {
 
 	// source and sink
 	numNodes := len(data) + 2
@@ -73,38 +104,36 @@ func (p *PseudoSolver) sendInput(data []float64, pre *Precedence) {
 			numArcs += len(pre.defs[ind])
 		}
 	}
-	n := []pseudo.N{}
-	a := []pseudo.A{}
+
+	p.numNodes = uint(numNodes)
+	p.numArcs = uint(numArcs)
+
 	const SOURCE = 1
-	n = append(n, pseudo.N{Val: SOURCE, Node: "s"})
 	SINK := numNodes
-	n = append(n, pseudo.N{Val: uint(SINK), Node: "t"})
 
-	//fmt.Fprintf(st, "p max %v %v\n", numNodes, numArcs)
-	//fmt.Fprintf(st, "n %v s\n", SOURCE)
-	//fmt.Fprintf(st, "n %v t\n", SINK)
+	n := []pseudo.N{
+		{Val: SOURCE, Node: "s"},
+		{Val: uint(SINK), Node: "t"},
+	}
+	a := make([]pseudo.A, 0, numArcs)
 
 	var from_i, to_i int
 
+	// Any cut through a precedence arc must cost more than every positive block
+	infinite := 1
+
 	for i := 0; i < len(data); i++ {
-		// incorrect hack using precision to avoid decimals and cast into uint
-		// TODO: Actually we need to refactor pseudo.go etc such that
-		// capacity is a float64 as it is generally a large +- number
-		//capacity := math.Abs(data[i]) * p.Precision
-		//capacity := data[i] * p.Precision
-		capacity := uint(math.Abs(data[i] * p.Precision))
+		// Capacities are integers in pseudo, so scale by the precision
+		capacity := int(math.Round(math.Abs(data[i] * p.Precision)))
 		if data[i] < 0 {
 			from_i = i + 2
 			to_i = SINK
 		} else {
 			from_i = SOURCE
 			to_i = i + 2
+			infinite += capacity
 		}
-		a = append(a, pseudo.A{From: uint(from_i), To: uint(to_i), Capacity: int(capacity)})
-
-		//fmt.Print(a)
-		//fmt.Fprintf(st, "a %v %v %v\n", from_i, to_i, capacity)
-		//fmt.Printf("a %v %v %v\n", from_i, to_i, capacity)
+		a = append(a, pseudo.A{From: uint(from_i), To: uint(to_i), Capacity: capacity})
 	}
 
 	// Now the infinite ones
@@ -112,24 +141,10 @@ func (p *PseudoSolver) sendInput(data []float64, pre *Precedence) {
 		from_i = i + 2 // + 1 for pseudo, +1 for source
 		if ind := pre.keys[i]; ind != MISSING {
 			for _, off := range pre.defs[ind] {
-				a = append(a, pseudo.A{From: uint(from_i), To: uint(to_i + off), Capacity: math.MaxInt32})
-				//fmt.Print(a)
-				//fmt.Print("a %v %v %v\n", from_i, from_i+off, uint32(math.MaxUint32))
+				a = append(a, pseudo.A{From: uint(from_i), To: uint(from_i + off), Capacity: infinite})
 			}
 		}
 	}
-	//var header string
-	var w io.Writer
-	header := H
-
-	//s := pseudo.NewSession(pseudo.Context{LowestLabel: false, FifoBuckets: true, DisplayCut: true})
-	s := pseudo.NewSession(pseudo.Context{})
-	//(*pseudo.Session).RunNAWriter(s, uint(numNodes), uint(numArcs), n, a, w, header)
-	var err error
-	//var buf bytes.Buffer
-	if err = s.RunNAWriter(uint(numNodes), uint(numArcs), n, a, w, header); err != nil {
-		log.Fatal(err)
-	}
-	//result := string(buf.Bytes())
-	//fmt.Print(result)
+
+	return n, a
 }
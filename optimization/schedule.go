@@ -0,0 +1,397 @@
+package optimization
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// A schedule of the blocks of the pit by period. The blocks are put in
+	// an order that keeps the precedence, the nested shells or phases first
+	// (if any), then the benches from the top and then by value. In that
+	// order each block is mined in the first period after its predecessors
+	// with room for it, within the mining capacity and, if it is ore, the
+	// processing capacity. Improvements then move blocks of positive value
+	// earlier and of negative value later, while the NPV rises. Blocks that
+	// fit in none of the periods are not mined.
+	ScheduleParam struct {
+		Periods            int     `json:"periods"`
+		DiscountRate       float64 `json:"discount_rate"`
+		MiningCapacity     float64 `json:"mining_capacity"`
+		ProcessingCapacity float64 `json:"processing_capacity"`
+		Improvements       int     `json:"improvements"`
+	}
+
+	// The schedule of one realization
+	schedule struct {
+		param    *ScheduleParam
+		tonnes   []float64
+		ore      []bool
+		values   []float64
+		period   []int // 1 indexed, 0 if not mined
+		mined    []float64
+		milled   []float64
+		discount []float64 // of each period
+		skipped  int       // blocks of the pit in no period
+	}
+)
+
+// True if a schedule was requested
+func (this *ScheduleParam) enabled() bool {
+	return this.MiningCapacity > 0 || this.ProcessingCapacity > 0
+}
+
+func (this *ScheduleParam) check() error {
+	if this.Periods < 0 {
+		return fmt.Errorf("ERROR: periods must not be negative. Supplied: %v", this.Periods)
+	} else if this.DiscountRate < 0 {
+		return fmt.Errorf("ERROR: discount rate must not be negative. Supplied: %v", this.DiscountRate)
+	} else if this.MiningCapacity < 0 || this.ProcessingCapacity < 0 {
+		return fmt.Errorf("ERROR: capacities must not be negative")
+	}
+	return nil
+}
+
+// Schedule the pits, or the nested shells or phases, of each realization.
+// rows holds the 1 indexed pit, shell or phase of each block, 0 if not
+// mined. The result holds the 1 indexed period of each block, 0 if it is not
+// mined.
+func (ctx *Parameters) scheduling(cx context.Context, rows [][]int) ([][]int, error) {
+
+	values := outputEbv(&ctx.Input, len(rows))
+	periods := make([][]int, len(rows))
+
+	for r, row := range rows {
+
+		log.Infof("Scheduling realization %3v", r)
+
+		s := ctx.newSchedule(r, values[r])
+
+		if e := s.sequence(cx, ctx, row); e != nil {
+			return nil, e
+		}
+
+		npv := s.npv()
+
+		for pass := 1; pass <= ctx.Schedule.Improvements; pass++ {
+
+			moved, e := s.improve(cx, ctx)
+
+			if e != nil {
+				return nil, e
+			}
+
+			log.Infof("  Improvement %3v. Moved: %-8v NPV: %f", pass, moved, s.npv())
+
+			if moved == 0 {
+				break
+			}
+		}
+
+		if ctx.Schedule.Improvements > 0 {
+			log.Infof("  Improved the NPV from %f to %f", npv, s.npv())
+		}
+
+		s.log()
+
+		periods[r] = s.period
+	}
+
+	return periods, nil
+}
+
+func (ctx *Parameters) newSchedule(r int, values []float64) *schedule {
+
+	s := &schedule{
+		param:  &ctx.Schedule,
+		values: values,
+		period: make([]int, len(values)),
+	}
+
+	// Air takes no room in a period
+	s.tonnes, s.ore = ctx.blockTonnage(r, values)
+
+	return s
+}
+
+// The tonnes of a block, at the shell density
+func (ctx *Parameters) blockTonnes() float64 {
+
+	density := ctx.Shells.Density
+	if density <= 0 {
+		density = 1.0
+	}
+
+	g := &ctx.Input.Grid
+
+	return g.SizX * g.SizY * g.SizZ * density
+}
+
+// The tonnes and ore of each block of realization r, from the economics if
+// there are any. Else the blocks have the tonnes of the shell density and
+// those of positive value are ore, but air has no tonnes: the blocks above
+// the topography, or at the end of the grid as the mask takes them.
+func (ctx *Parameters) blockTonnage(r int, values []float64) ([]float64, []bool) {
+
+	n := len(values)
+	tonnes := make([]float64, n)
+	ore := make([]bool, n)
+
+	if len(ctx.Input.Tonnes) > 0 {
+		if r >= len(ctx.Input.Tonnes) {
+			r = 0
+		}
+		copy(tonnes, ctx.Input.Tonnes[r])
+		copy(ore, ctx.Input.Ore[r])
+		return tonnes, ore
+	}
+
+	air := ctx.Input.air()
+	from := ctx.Input.airFrom()
+	density := ctx.blockTonnes()
+
+	for i, v := range values {
+		if (air != nil && air[i]) || i >= from {
+			continue
+		}
+		tonnes[i] = density
+		ore[i] = v > 0
+	}
+
+	return tonnes, ore
+}
+
+// The first period from t with room for the block, 0 if none
+func (this *schedule) fit(i, t int) int {
+
+	for ; this.param.Periods <= 0 || t <= this.param.Periods; t++ {
+		if this.fits(i, t) {
+			return t
+		}
+	}
+
+	return 0
+}
+
+// True if period t has room for the block. An empty period takes any block,
+// however large.
+func (this *schedule) fits(i, t int) bool {
+
+	this.grow(t)
+
+	mine := this.param.MiningCapacity <= 0 || this.mined[t] == 0 ||
+		this.mined[t]+this.tonnes[i] <= this.param.MiningCapacity
+	mill := !this.ore[i] || this.param.ProcessingCapacity <= 0 || this.milled[t] == 0 ||
+		this.milled[t]+this.tonnes[i] <= this.param.ProcessingCapacity
+
+	return mine && mill
+}
+
+// Make room for the totals of period t. Period t is discounted by t periods.
+func (this *schedule) grow(t int) {
+	for len(this.mined) <= t {
+		this.mined = append(this.mined, 0)
+		this.milled = append(this.milled, 0)
+		this.discount = append(this.discount, math.Pow(1+this.param.DiscountRate, -float64(len(this.discount))))
+	}
+}
+
+func (this *schedule) place(i, t int) {
+
+	if p := this.period[i]; p > 0 {
+		this.mined[p] -= this.tonnes[i]
+		if this.ore[i] {
+			this.milled[p] -= this.tonnes[i]
+		}
+	}
+
+	this.period[i] = t
+
+	if t > 0 {
+		this.grow(t)
+		this.mined[t] += this.tonnes[i]
+		if this.ore[i] {
+			this.milled[t] += this.tonnes[i]
+		}
+	}
+}
+
+// The first period the predecessors allow, 0 if one of them is not mined
+func (this *schedule) earliest(ctx *Parameters, i int) int {
+
+	t := 1
+
+	if key := ctx.Precedence.keys[i]; key != MISSING {
+		for _, off := range ctx.Precedence.defs[key] {
+			p := this.period[i+off]
+			if p == 0 {
+				return 0
+			} else if p > t {
+				t = p
+			}
+		}
+	}
+
+	return t
+}
+
+// Place the blocks of the pit in order
+func (this *schedule) sequence(cx context.Context, ctx *Parameters, row []int) error {
+
+	g := &ctx.Input.Grid
+	var order []int
+
+	for i, v := range row {
+		if v != 0 {
+			order = append(order, i)
+		}
+	}
+
+	// The predecessors of a block are in the same or an earlier shell or
+	// phase, and on the benches above, so they come first
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if row[i] != row[j] {
+			return row[i] < row[j]
+		} else if g.gridIz(i) != g.gridIz(j) {
+			return g.gridIz(i) > g.gridIz(j)
+		}
+		return this.values[i] > this.values[j]
+	})
+
+	for n, i := range order {
+
+		if n%CANCEL_CHECK == 0 {
+			if e := cx.Err(); e != nil {
+				return e
+			}
+		}
+
+		if t := this.earliest(ctx, i); t > 0 {
+			this.place(i, this.fit(i, t))
+		}
+
+		if this.period[i] == 0 {
+			this.skipped++
+		}
+	}
+
+	return nil
+}
+
+// Move each block of positive value to the first period it fits in before
+// its own, and each of negative value to the last after it, within its
+// predecessors and successors. Returns the number of blocks moved.
+func (this *schedule) improve(cx context.Context, ctx *Parameters) (int, error) {
+
+	// The last period each block may be mined in, for its successors
+	latest := make([]int, len(this.period))
+
+	for i, p := range this.period {
+		if p > 0 {
+			if key := ctx.Precedence.keys[i]; key != MISSING {
+				for _, off := range ctx.Precedence.defs[key] {
+					if l := latest[i+off]; l == 0 || p < l {
+						latest[i+off] = p
+					}
+				}
+			}
+		}
+	}
+
+	last := len(this.mined) - 1
+	moved := 0
+
+	for i, p := range this.period {
+
+		if i%CANCEL_CHECK == 0 {
+			if e := cx.Err(); e != nil {
+				return moved, e
+			}
+		}
+
+		if p == 0 || this.values[i] == 0 {
+			continue
+		}
+
+		// Free the block's room while looking for another
+		this.place(i, 0)
+
+		t := p
+
+		if this.values[i] > 0 {
+			if f := this.fit(i, this.earliest(ctx, i)); f > 0 && f < p {
+				t = f
+			}
+		} else {
+			l := latest[i]
+			if l == 0 {
+				l = last
+			}
+			for f := l; f > p; f-- {
+				if this.fits(i, f) {
+					t = f
+					break
+				}
+			}
+		}
+
+		this.place(i, t)
+
+		if t != p {
+			moved++
+			// Keep the bounds of the predecessors
+			if key := ctx.Precedence.keys[i]; key != MISSING {
+				for _, off := range ctx.Precedence.defs[key] {
+					if l := latest[i+off]; l == 0 || t < l {
+						latest[i+off] = t
+					}
+				}
+			}
+		}
+	}
+
+	return moved, nil
+}
+
+// The value discounted to the start of the first period, each period's
+// value coming at its end
+func (this *schedule) npv() float64 {
+
+	var npv float64
+
+	for i, t := range this.period {
+		if t > 0 {
+			npv += this.values[i] * this.discount[t]
+		}
+	}
+
+	return npv
+}
+
+// Log the tonnage, value and NPV of every period
+func (this *schedule) log() {
+
+	periods := len(this.mined) - 1
+	values := make([]float64, periods+1)
+
+	for i, t := range this.period {
+		if t > 0 {
+			values[t] += this.values[i]
+		}
+	}
+
+	for t := 1; t <= periods; t++ {
+		log.Infof(
+			"  Period %3v. Tonnage: %-14.1f Ore: %-14.1f Waste: %-14.1f EBV: %-16f Discounted: %f",
+			t, this.mined[t], this.milled[t], this.mined[t]-this.milled[t],
+			values[t], values[t]*this.discount[t],
+		)
+	}
+
+	log.Infof("  Periods: %v, NPV: %f, blocks of the pit not mined: %v", periods, this.npv(), this.skipped)
+}
@@ -0,0 +1,101 @@
+package optimization
+
+import (
+	"context"
+	"testing"
+)
+
+// The air above the pit takes no room in a period, so the ore below is
+// mined in the first periods
+func TestScheduleAirAbovePit(t *testing.T) {
+
+	grid := Grid{NumX: 1, NumY: 1, NumZ: 4, SizX: 10, SizY: 10, SizZ: 10}
+
+	ctx := &Parameters{
+		Input:      Data{Grid: grid, Ebv: [][]float64{{10, 10, 0, 0}}},
+		Precedence: Precedence{Method: PATTERN_1_5},
+		Schedule:   ScheduleParam{MiningCapacity: 1000},
+	}
+
+	if e := ctx.Precedence.init(ctx, []bool{true, true, true, true}); e != nil {
+		t.Fatal(e)
+	}
+
+	periods, e := ctx.scheduling(context.Background(), [][]int{{1, 1, 1, 1}})
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	want := []int{2, 1, 1, 1}
+
+	for i, p := range periods[0] {
+		if p != want[i] {
+			t.Fatalf("periods %v, want %v", periods[0], want)
+		}
+	}
+}
+
+// Blocks worth nothing inside the model are waste with tonnes, only those
+// above the topography or at the end of the grid are air
+func TestBlockTonnage(t *testing.T) {
+
+	grid := Grid{NumX: 1, NumY: 1, NumZ: 5, SizX: 10, SizY: 10, SizZ: 10}
+
+	ctx := &Parameters{
+		Input:  Data{Grid: grid, Ebv: [][]float64{{10, 0, 5, 0, 0}, {8, 0, -1, 0, 0}}},
+		Shells: ShellParam{Density: 2},
+	}
+
+	tests := []struct {
+		name       string
+		topography []float64
+		r          int
+		tonnes     []float64
+		ore        []bool
+	}{
+		{"grid", nil, 0, []float64{2000, 2000, 2000, 0, 0}, []bool{true, false, true, false, false}},
+		{"realization", nil, 1, []float64{2000, 2000, 2000, 0, 0}, []bool{true, false, false, false, false}},
+		// The surface at 22 is below the centroid of the block from 20 to 30
+		{"topography", []float64{22}, 0, []float64{2000, 2000, 0, 0, 0}, []bool{true, false, false, false, false}},
+	}
+
+	for _, test := range tests {
+
+		ctx.Input.Topography = test.topography
+		tonnes, ore := ctx.blockTonnage(test.r, ctx.Input.Ebv[test.r])
+
+		for i := range test.tonnes {
+			if tonnes[i] != test.tonnes[i] || ore[i] != test.ore[i] {
+				t.Errorf("%v: tonnes %v ore %v, want %v and %v", test.name, tonnes, ore, test.tonnes, test.ore)
+				break
+			}
+		}
+	}
+}
+
+// The air at the end of the grid starts after the last block worth
+// something in any realization
+func TestAirFrom(t *testing.T) {
+
+	grid := Grid{NumX: 5, NumY: 1, NumZ: 1, SizX: 1, SizY: 1, SizZ: 1}
+
+	tests := []struct {
+		ebv  [][]float64
+		want int
+	}{
+		{[][]float64{{1, 0, 2, 0, 0}}, 3},
+		{[][]float64{{1, 0, 2, 0, 0}, {0, 0, 0, -1, 0}}, 4},
+		{[][]float64{{1, 0, 2, 0, 3}}, 5},
+		{[][]float64{{0, 0, 0, 0, 0}}, 1},
+	}
+
+	for _, test := range tests {
+
+		data := &Data{Grid: grid, Ebv: test.ebv}
+
+		if got := data.airFrom(); got != test.want {
+			t.Errorf("%v: air from %v, want %v", test.ebv, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package optimization
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type (
+	// An overall slope angle (in degrees) at an azimuth (in degrees,
+	// clockwise from north).
+	SlopeSector struct {
+		Azimuth float64 `json:"azimuth"`
+		Slope   float64 `json:"slope"`
+	}
+
+	Sectors []SlopeSector
+)
+
+func (this *Precedence) checkSectors() error {
+	return this.Sectors.check()
+}
+
+func (this Sectors) check() error {
+
+	if len(this) == 0 {
+		return fmt.Errorf("ERROR: at least one slope sector is required")
+	}
+
+	for _, s := range this {
+		if s.Azimuth < 0 || s.Azimuth >= 360 {
+			return fmt.Errorf("ERROR: azimuth must be between 0 and 360. Supplied: %v", s.Azimuth)
+		} else if e := checkSlope(s.Slope); e != nil {
+			return fmt.Errorf("%v (azimuth %v)", e, s.Azimuth)
+		}
+	}
+
+	return nil
+}
+
+// Sorted by azimuth
+func (this Sectors) sorted() Sectors {
+	sorted := make(Sectors, len(this))
+	copy(sorted, this)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Azimuth < sorted[j].Azimuth })
+	return sorted
+}
+
+// The slope at the azimuth, linearly interpolated between the neighbouring
+// sectors. The sectors must be sorted.
+func (this Sectors) slopeAt(azimuth float64) float64 {
+
+	n := len(this)
+
+	if n == 1 {
+		return this[0].Slope
+	}
+
+	// The first sector after the azimuth, wrapping around north
+	next := sort.Search(n, func(i int) bool { return this[i].Azimuth >= azimuth })
+	prev := next - 1
+
+	if next == n {
+		next = 0
+	}
+	if prev < 0 {
+		prev = n - 1
+	}
+
+	from := this[prev].Azimuth
+	span := math.Mod(this[next].Azimuth-from+360.0, 360.0)
+	dist := math.Mod(azimuth-from+360.0, 360.0)
+
+	if span == 0 {
+		return this[prev].Slope
+	}
+
+	return this[prev].Slope + (this[next].Slope-this[prev].Slope)*dist/span
+}
+
+func (this Sectors) minSlope() float64 {
+	min := this[0].Slope
+	for _, s := range this {
+		min = math.Min(min, s.Slope)
+	}
+	return min
+}
+
+// Like genBench, but the cone radius depends on the azimuth
+func (this *Precedence) genSectors(ctx *Parameters, mask []bool) {
+
+	pg := &ctx.Input.Grid
+
+	tmpl := this.sectorTemplate(pg, this.Sectors)
+
+	this.applyTemplate(pg, mask, tmpl)
+}
+
+func (this *Precedence) sectorTemplate(pg *Grid, sectors Sectors) *Template {
+
+	sorted := sectors.sorted()
+
+	// The flattest slope reaches the furthest
+	theta := sorted.minSlope() * math.Pi / 180.0
+	maxVert := float64(this.NumBenches) * pg.SizZ
+	maxRadius := maxVert / math.Tan(theta)
+
+	return this.genTemplate(pg, maxRadius, sorted.cone())
+}
+
+// True if the offset is inside the exact cone. The sectors must be sorted.
+func (this Sectors) cone() func(xloc, yloc, zloc float64) bool {
+
+	return func(xloc, yloc, zloc float64) bool {
+
+		azimuth := math.Atan2(xloc, yloc) * 180.0 / math.Pi
+		if azimuth < 0 {
+			azimuth += 360.0
+		}
+
+		rad := zloc / math.Tan(this.slopeAt(azimuth)*math.Pi/180.0)
+
+		return xloc*xloc+yloc*yloc <= rad*rad
+	}
+}
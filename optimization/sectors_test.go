@@ -0,0 +1,52 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+)
+
+// The slope is interpolated between the sectors either side, wrapping
+// around north
+func TestSectorSlopeAt(t *testing.T) {
+
+	sectors := Sectors{{Azimuth: 270, Slope: 50}, {Azimuth: 0, Slope: 40}, {Azimuth: 90, Slope: 60}}.sorted()
+
+	tests := [][2]float64{{0, 40}, {45, 50}, {90, 60}, {180, 55}, {270, 50}, {315, 45}, {359, 40 + 10.0/90}}
+
+	for _, test := range tests {
+		if s := sectors.slopeAt(test[0]); math.Abs(s-test[1]) > 1e-9 {
+			t.Errorf("slope at %v is %v, want %v", test[0], s, test[1])
+		}
+	}
+
+	if s := (Sectors{{Azimuth: 120, Slope: 35}}).slopeAt(300); s != 35 {
+		t.Errorf("single sector slope is %v, want 35", s)
+	}
+}
+
+// A flat west wall reaches further than a steep east wall
+func TestSectorTemplate(t *testing.T) {
+
+	pre := &Precedence{Method: SECTORS, NumBenches: 2}
+	grid := &Grid{NumX: 9, NumY: 9, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}
+
+	tmpl := pre.sectorTemplate(grid, Sectors{{Azimuth: 90, Slope: 80}, {Azimuth: 270, Slope: 30}})
+
+	west, east := 0, 0
+
+	for i := range tmpl.ixs {
+		if ix := tmpl.ixs[i]; tmpl.iys[i] == 0 && ix < west {
+			west = ix
+		} else if tmpl.iys[i] == 0 && ix > east {
+			east = ix
+		}
+	}
+
+	if west > -2 || east != 0 {
+		t.Errorf("template reaches %v blocks west and %v east, want 2 or more west and none east", -west, east)
+	}
+
+	if e := (Sectors{{Azimuth: 360, Slope: 45}}).check(); e == nil {
+		t.Error("azimuth 360 accepted")
+	}
+}
@@ -0,0 +1,166 @@
+package optimization
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	ShellParam struct {
+		RevenueFactors []float64 `json:"revenue_factors"`
+		Density        float64   `json:"density"`
+	}
+)
+
+// True if nested pit shells were requested
+func (this *ShellParam) enabled() bool {
+	return len(this.RevenueFactors) > 0
+}
+
+// The revenue factors in ascending order
+func (this *ShellParam) factors() ([]float64, error) {
+
+	factors := make([]float64, len(this.RevenueFactors))
+	copy(factors, this.RevenueFactors)
+	sort.Float64s(factors)
+
+	for i, f := range factors {
+		if f <= 0 {
+			return nil, fmt.Errorf("ERROR: revenue factors must be positive. Supplied: %v", f)
+		} else if i > 0 && f == factors[i-1] {
+			return nil, fmt.Errorf("ERROR: revenue factor %v supplied more than once", f)
+		}
+	}
+
+	return factors, nil
+}
+
+// Solve one pit per revenue factor, scaling only the positive EBVs. The
+// result holds, for each realization and block, the 1 indexed shell the
+// block is first mined in, or 0 if it is never mined.
+func (ctx *Parameters) optimizingShells(cx context.Context) ([][]int, error) {
+
+	factors, e := ctx.Shells.factors()
+
+	if e == nil && ctx.Stochastic.enabled() {
+		e = fmt.Errorf("ERROR: shells cannot be combined with a stochastic objective")
+	} else if e == nil && ctx.Discount.enabled() {
+		e = fmt.Errorf("ERROR: shells cannot be combined with a discount")
+	}
+
+	if e != nil {
+		log.Error(e)
+		return nil, &ParameterError{e}
+	}
+
+	nReal := len(ctx.Input.Ebv)
+
+	mask, condensedEBV, condensedPre, e := ctx.prepare(cx)
+
+	if e != nil {
+		return nil, e
+	}
+
+	log.Infof("Begin optimizing %v shells", len(factors))
+
+	shells := make([][]int, nReal)
+	pits := make([][]bool, len(factors))
+	nf := len(factors)
+
+	// Solve i is realization i / nf with the factor i % nf
+	values := func(i int) []float64 {
+
+		ebv := condensedEBV.Ebv[i/nf]
+		scaled := make([]float64, len(ebv))
+
+		for j, v := range ebv {
+			if v > 0 {
+				scaled[j] = v * factors[i%nf]
+			} else {
+				scaled[j] = v
+			}
+		}
+
+		return scaled
+	}
+
+	e = ctx.solveAll(cx, nReal*nf, values, condensedPre, func(i int, row []bool) {
+
+		r, k := i/nf, i%nf
+
+		// Keep the shells nested, even when the engine breaks ties differently
+		if k > 0 {
+			for i, v := range pits[k-1] {
+				row[i] = row[i] || v
+			}
+		}
+
+		pits[k] = row
+
+		if k < nf-1 {
+			return
+		}
+
+		shells[r] = make([]int, len(mask))
+
+		full := ctx.decompress(mask, pits)
+
+		for k := len(full) - 1; k >= 0; k-- {
+			for i, v := range full[k] {
+				if v {
+					shells[r][i] = k + 1
+				}
+			}
+		}
+
+		ctx.logShells(r, factors, shells[r])
+	})
+
+	if e != nil {
+		return nil, e
+	}
+
+	return shells, nil
+}
+
+// Log the tonnage and value of every shell, cumulative and incremental
+func (ctx *Parameters) logShells(r int, factors []float64, shell []int) {
+
+	density := ctx.Shells.Density
+	if density <= 0 {
+		density = 1.0
+	}
+
+	g := &ctx.Input.Grid
+	tonnes := g.SizX * g.SizY * g.SizZ * density
+
+	blocks := make([]int64, len(factors)+1)
+	values := make([]float64, len(factors)+1)
+
+	for i, k := range shell {
+		if k > 0 {
+			blocks[k]++
+			values[k] += ctx.Input.Ebv[r][i]
+		}
+	}
+
+	log.Infof("Shells for realization %3v", r)
+
+	var cumBlocks int64
+	var cumValue float64
+
+	for k, f := range factors {
+
+		cumBlocks += blocks[k+1]
+		cumValue += values[k+1]
+
+		log.Infof(
+			"  Shell %3v RF %6.3f. Blocks: %-8v Tonnage: %-14.1f EBV: %-16f Increment blocks: %-8v Tonnage: %-14.1f EBV: %f",
+			k+1, f, cumBlocks, float64(cumBlocks)*tonnes, cumValue,
+			blocks[k+1], float64(blocks[k+1])*tonnes, values[k+1],
+		)
+	}
+}
@@ -0,0 +1,45 @@
+package optimization
+
+import (
+	"context"
+	"testing"
+)
+
+// A single column, each block needing the one above. The top two blocks
+// pay at a revenue factor of 1, the whole column only at 2.
+func TestShellsNested(t *testing.T) {
+
+	ctx := &Parameters{
+		Input: Data{
+			Grid: Grid{NumX: 1, NumY: 1, NumZ: 4, SizX: 10, SizY: 10, SizZ: 10},
+			Ebv:  [][]float64{{9, -10, 6, -4}},
+		},
+		Precedence:  Precedence{Method: BENCH, Slope: 45, NumBenches: 1},
+		EngineParam: EngineParam{EngineType: Engine_LERCHSGROSSMANN},
+		Shells:      ShellParam{RevenueFactors: []float64{2, 0.5, 1}},
+	}
+
+	shells, e := ctx.optimizingShells(context.Background())
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	want := []int{3, 3, 2, 2}
+
+	for i, k := range shells[0] {
+		if k != want[i] {
+			t.Fatalf("shells %v, want %v", shells[0], want)
+		}
+	}
+}
+
+// Revenue factors must be positive and different
+func TestShellFactors(t *testing.T) {
+
+	for _, factors := range [][]float64{{1, 0}, {-1}, {0.5, 1, 0.5}} {
+		if _, e := (&ShellParam{RevenueFactors: factors}).factors(); e == nil {
+			t.Errorf("factors %v accepted", factors)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package optimization
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// Find a single pit for every realization. The expected objective
+	// maximizes the mean value. The downside objective maximizes the pit's
+	// mean value less lambda times its mean shortfall below that mean,
+	// weighting the realizations below the mean under the last pit for a
+	// number of iterations. The CVaR objective maximizes the mean value of
+	// the worst alpha of the realizations, reweighting the realizations for
+	// a number of iterations. Both keep the best pit.
+	StochasticParam struct {
+		Objective  int     `json:"objective"`
+		Lambda     float64 `json:"lambda"`
+		Alpha      float64 `json:"alpha"`
+		Iterations int     `json:"iterations"`
+	}
+)
+
+const (
+	Objective_EXPECTED = iota + 1
+	Objective_DOWNSIDE
+	Objective_CVAR
+)
+
+const (
+	DEFAULT_CVAR_ALPHA      = 0.1
+	DEFAULT_CVAR_ITERATIONS = 20
+)
+
+// True if a single pit was requested
+func (this *StochasticParam) enabled() bool {
+	return this.Objective != 0
+}
+
+func (this *StochasticParam) check() error {
+
+	switch this.Objective {
+	case Objective_EXPECTED:
+	case Objective_DOWNSIDE:
+		if this.Lambda < 0 {
+			return fmt.Errorf("ERROR: lambda must not be negative. Supplied: %v", this.Lambda)
+		}
+	case Objective_CVAR:
+		if this.Alpha < 0 || this.Alpha > 1 {
+			return fmt.Errorf("ERROR: alpha must be between 0 and 1. Supplied: %v", this.Alpha)
+		}
+	default:
+		return fmt.Errorf("ERROR: invalid stochastic objective: %v", this.Objective)
+	}
+
+	return nil
+}
+
+// The number of worst realizations the CVaR is taken over
+func (this *StochasticParam) worst(nReal int) int {
+
+	alpha := this.Alpha
+	if alpha <= 0 {
+		alpha = DEFAULT_CVAR_ALPHA
+	}
+
+	return int(math.Ceil(alpha * float64(nReal)))
+}
+
+// The number of times the realizations are reweighted
+func (this *StochasticParam) iterations() int {
+
+	if this.Iterations <= 0 {
+		return DEFAULT_CVAR_ITERATIONS
+	}
+
+	return this.Iterations
+}
+
+// The downside objective of the values of a pit in each realization: their
+// mean less lambda times their mean shortfall below it
+func (this *StochasticParam) downside(values []float64) float64 {
+
+	m := mean(values)
+
+	var shortfall float64
+	for _, v := range values {
+		shortfall += math.Max(0, m-v)
+	}
+
+	return m - this.Lambda*shortfall/float64(len(values))
+}
+
+// Block values weighting the values of each realization
+func weighted(ebv [][]float64, weights []float64) []float64 {
+
+	values := make([]float64, len(ebv[0]))
+
+	for r, layer := range ebv {
+		for i, v := range layer {
+			values[i] += weights[r] * v
+		}
+	}
+
+	return values
+}
+
+// Equal weights for every realization
+func uniform(nReal int) []float64 {
+
+	weights := make([]float64, nReal)
+	for r := range weights {
+		weights[r] = 1.0 / float64(nReal)
+	}
+
+	return weights
+}
+
+// Solve the single pit. The result has that pit and its value under each
+// realization.
+func (ctx *Parameters) optimizingStochastic(cx context.Context) (*Result, error) {
+
+	sp := &ctx.Stochastic
+
+	if e := sp.check(); e != nil {
+		log.Error(e)
+		return nil, &ParameterError{e}
+	}
+
+	start := time.Now()
+
+	mask, condensedEBV, condensedPre, e := ctx.prepare(cx)
+
+	if e != nil {
+		return nil, e
+	}
+
+	log.Infof("Begin optimizing a single pit for %v realizations", len(ctx.Input.Ebv))
+
+	var selected []bool
+
+	switch sp.Objective {
+	case Objective_DOWNSIDE:
+		selected, e = ctx.solveDownside(cx, condensedEBV.Ebv, condensedPre)
+	case Objective_CVAR:
+		selected, e = ctx.solveCVaR(cx, condensedEBV.Ebv, condensedPre)
+	default:
+		selected, e = ctx.solveWeighted(cx, weighted(condensedEBV.Ebv, uniform(len(condensedEBV.Ebv))), condensedPre)
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	log.Info("Decompressing solution")
+
+	full := ctx.decompress(mask, [][]bool{selected})[0]
+
+	result := &Result{
+		Statistics: condensedPre.statistics(len(mask)),
+		Values:     make([]float64, len(ctx.Input.Ebv)),
+	}
+
+	for r, layer := range ctx.Input.Ebv {
+		result.Values[r] = newPit(full, layer).Value
+	}
+
+	pit := newPit(full, ctx.Input.Ebv[0])
+	pit.Value = mean(result.Values)
+	result.Pits = []Pit{pit}
+
+	ctx.logStochastic(pit, result.Values)
+
+	result.Statistics.Elapsed = time.Since(start)
+
+	return result, nil
+}
+
+// Solve one set of condensed values
+func (ctx *Parameters) solveWeighted(cx context.Context, values []float64, pre *Precedence) ([]bool, error) {
+
+	var selected []bool
+
+	e := ctx.solveAll(cx, 1, func(int) []float64 { return values }, pre, func(_ int, row []bool) {
+		selected = row
+	})
+
+	return selected, e
+}
+
+// The shortfall is linear in the values of the realizations below the mean,
+// so with those fixed the objective weights each realization 1/n, less
+// lambda |S|/n^2, plus lambda/n if it is one of the S below the mean. The
+// realizations below the mean start as those of the expected pit, and each
+// iteration takes them from the last pit until they repeat.
+func (ctx *Parameters) solveDownside(cx context.Context, ebv [][]float64, pre *Precedence) ([]bool, error) {
+
+	sp := &ctx.Stochastic
+	nReal := len(ebv)
+	n := float64(nReal)
+	weights := uniform(nReal)
+
+	var best []bool
+	bestObjective := math.Inf(-1)
+	seen := make(map[string]bool)
+
+	for it := 1; it <= sp.iterations(); it++ {
+
+		selected, e := ctx.solveWeighted(cx, weighted(ebv, weights), pre)
+
+		if e != nil {
+			return nil, e
+		}
+
+		pitValues := make([]float64, nReal)
+		for r, layer := range ebv {
+			pitValues[r] = newPit(selected, layer).Value
+		}
+
+		objective := sp.downside(pitValues)
+
+		log.Infof("Downside iteration %3v. Mean: %f, Objective: %f", it, mean(pitValues), objective)
+
+		if objective > bestObjective {
+			best, bestObjective = selected, objective
+		}
+
+		m := mean(pitValues)
+		var below []int
+		for r, v := range pitValues {
+			if v < m {
+				below = append(below, r)
+			}
+		}
+
+		key := fmt.Sprint(below)
+		if seen[key] {
+			break
+		}
+		seen[key] = true
+
+		for r := range weights {
+			weights[r] = (1 - sp.Lambda*float64(len(below))/n) / n
+		}
+		for _, r := range below {
+			weights[r] += sp.Lambda / n
+		}
+	}
+
+	return best, nil
+}
+
+// The weights start uniform, then each iteration adds the worst alpha of
+// the realizations under the last pit to the average of the weights so far.
+func (ctx *Parameters) solveCVaR(cx context.Context, ebv [][]float64, pre *Precedence) ([]bool, error) {
+
+	sp := &ctx.Stochastic
+	nReal := len(ebv)
+	k := sp.worst(nReal)
+
+	weights := uniform(nReal)
+
+	var best []bool
+	bestCVaR := math.Inf(-1)
+	seen := make(map[string]bool)
+
+	for it := 1; it <= sp.iterations(); it++ {
+
+		selected, e := ctx.solveWeighted(cx, weighted(ebv, weights), pre)
+
+		if e != nil {
+			return nil, e
+		}
+
+		pitValues := make([]float64, nReal)
+		for r, layer := range ebv {
+			pitValues[r] = newPit(selected, layer).Value
+		}
+
+		worst := worstRealizations(pitValues, k)
+		cvar := mean(pick(pitValues, worst))
+
+		log.Infof("CVaR iteration %3v. Mean: %f, CVaR: %f", it, mean(pitValues), cvar)
+
+		if cvar > bestCVaR {
+			best, bestCVaR = selected, cvar
+		}
+
+		key := fmt.Sprint(worst)
+		if seen[key] {
+			break
+		}
+		seen[key] = true
+
+		// Average in the worst realizations, each weighted 1/k
+		for r := range weights {
+			weights[r] *= float64(it) / float64(it+1)
+		}
+		for _, r := range worst {
+			weights[r] += 1.0 / float64(k) / float64(it+1)
+		}
+	}
+
+	return best, nil
+}
+
+func (ctx *Parameters) logStochastic(pit Pit, values []float64) {
+
+	sp := &ctx.Stochastic
+
+	log.Infof("Single pit. Blocks: %v", pit.Blocks)
+
+	for r, v := range values {
+		log.Infof("  Realization %3v. EBV: %f", r, v)
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var downside float64
+	m := mean(values)
+	for _, v := range values {
+		downside += math.Max(0, m-v)
+	}
+	downside /= float64(len(values))
+
+	line := []string{
+		fmt.Sprintf("Mean: %f", m),
+		fmt.Sprintf("Min: %f", sorted[0]),
+		fmt.Sprintf("Max: %f", sorted[len(sorted)-1]),
+		fmt.Sprintf("Downside: %f", downside),
+	}
+
+	if sp.Objective == Objective_DOWNSIDE {
+		line = append(line, fmt.Sprintf("Objective (lambda %v): %f", sp.Lambda, sp.downside(values)))
+	}
+
+	if sp.Objective == Objective_CVAR {
+		k := sp.worst(len(values))
+		line = append(line, fmt.Sprintf("CVaR (%v worst): %f", k, mean(sorted[:k])))
+	}
+
+	log.Info(strings.Join(line, ", "))
+}
+
+// The indices of the k lowest values, in ascending order of index
+func worstRealizations(values []float64, k int) []int {
+
+	idx := make([]int, len(values))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	sort.SliceStable(idx, func(a, b int) bool { return values[idx[a]] < values[idx[b]] })
+
+	worst := idx[:k]
+	sort.Ints(worst)
+
+	return worst
+}
+
+func pick(values []float64, idx []int) []float64 {
+	picked := make([]float64, len(idx))
+	for i, j := range idx {
+		picked[i] = values[j]
+	}
+	return picked
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,168 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+)
+
+// A column of three blocks, the top one first in each realization's list
+// of values below. The middle block pays on average but loses heavily in
+// the last realization.
+func stochasticColumn(t *testing.T) *BlockModel {
+
+	top := []float64{5, 5, 5, 5}
+	middle := []float64{10, 10, 10, -26}
+
+	values := make([][]float64, len(top))
+	for r := range values {
+		// The grid is stored from the bottom up
+		values[r] = []float64{-1, middle[r], top[r]}
+	}
+
+	model, e := NewBlockModel(Grid{NumX: 1, NumY: 1, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}, values...)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	return model
+}
+
+func stochasticOptions(sp StochasticParam) Options {
+	return Options{
+		Precedence: Precedence{Method: BENCH, Slope: 45, NumBenches: 1},
+		Engine:     EngineParam{EngineType: Engine_LERCHSGROSSMANN},
+		Stochastic: sp,
+	}
+}
+
+// The downside objective is the mean less lambda times the mean shortfall
+// of the pit's values below it
+func TestStochasticDownside(t *testing.T) {
+
+	sp := StochasticParam{Objective: Objective_DOWNSIDE, Lambda: 1.5}
+
+	// Mean 2, short by 2 and by 4 in two of the four
+	if got := sp.downside([]float64{4, 0, -2, 6}); math.Abs(got-(2-1.5*6.0/4)) > 1e-9 {
+		t.Errorf("downside %v, want %v", got, 2-1.5*6.0/4)
+	}
+
+	if got := weighted([][]float64{{4, -2}, {0, -2}, {2, -8}}, uniform(3)); math.Abs(got[0]-2) > 1e-9 || math.Abs(got[1]+4) > 1e-9 {
+		t.Errorf("mean values %v, want [2 -4]", got)
+	}
+}
+
+func TestStochasticWorst(t *testing.T) {
+
+	if got := worstRealizations([]float64{5, 1, 3, 0}, 2); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("worst 2 are %v, want [1 3]", got)
+	}
+
+	if k := new(StochasticParam).worst(25); k != 3 {
+		t.Errorf("default alpha takes %v of 25, want 3", k)
+	}
+
+	for _, sp := range []StochasticParam{{Objective: 9}, {Objective: Objective_DOWNSIDE, Lambda: -1}, {Objective: Objective_CVAR, Alpha: 2}} {
+		if sp.check() == nil {
+			t.Errorf("%+v accepted", sp)
+		}
+	}
+}
+
+// The expected pit takes the middle block for its mean, the CVaR pit of the
+// worst realization leaves it
+func TestStochasticPit(t *testing.T) {
+
+	model := stochasticColumn(t)
+
+	tests := []struct {
+		sp     StochasticParam
+		blocks int64
+		values []float64
+	}{
+		{StochasticParam{Objective: Objective_EXPECTED}, 2, []float64{15, 15, 15, -21}},
+		{StochasticParam{Objective: Objective_CVAR, Alpha: 0.25}, 1, []float64{5, 5, 5, 5}},
+		// The pit's shortfall is 6.75, less than its extra mean of 1 over
+		// the top block with a small lambda
+		{StochasticParam{Objective: Objective_DOWNSIDE, Lambda: 0.1}, 2, []float64{15, 15, 15, -21}},
+		{StochasticParam{Objective: Objective_DOWNSIDE, Lambda: 0.5}, 1, []float64{5, 5, 5, 5}},
+	}
+
+	for _, test := range tests {
+
+		result, e := Optimize(model, stochasticOptions(test.sp))
+
+		if e != nil {
+			t.Fatal(e)
+		}
+
+		if len(result.Pits) != 1 {
+			t.Fatalf("objective %v: %v pits, want one", test.sp.Objective, len(result.Pits))
+		}
+
+		pit := result.Pits[0]
+
+		if pit.Blocks != test.blocks || pit.Value != mean(test.values) {
+			t.Errorf("objective %v: %v blocks worth %v, want %v worth %v",
+				test.sp.Objective, pit.Blocks, pit.Value, test.blocks, mean(test.values))
+		}
+
+		for r, v := range test.values {
+			if result.Values[r] != v {
+				t.Errorf("objective %v: values %v, want %v", test.sp.Objective, result.Values, test.values)
+				break
+			}
+		}
+	}
+}
+
+// Blocks that fall short in different realizations hedge each other. The
+// downside pit of the column is the best of its closed pits, taking both
+// blocks where either alone falls short by 4.
+func TestStochasticDownsidePit(t *testing.T) {
+
+	top := []float64{10, -6}
+	middle := []float64{-6, 10}
+
+	values := make([][]float64, len(top))
+	for r := range values {
+		values[r] = []float64{-1, middle[r], top[r]}
+	}
+
+	model, e := NewBlockModel(Grid{NumX: 1, NumY: 1, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}, values...)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	for _, lambda := range []float64{0, 0.5, 1, 2} {
+
+		sp := StochasticParam{Objective: Objective_DOWNSIDE, Lambda: lambda}
+
+		// The closed pits of the column are the top k blocks
+		best := math.Inf(-1)
+		for k := 0; k <= 3; k++ {
+			pit := make([]float64, len(values))
+			for r := range values {
+				for i := 3 - k; i < 3; i++ {
+					pit[r] += values[r][i]
+				}
+			}
+			best = math.Max(best, sp.downside(pit))
+		}
+
+		result, e := Optimize(model, stochasticOptions(sp))
+
+		if e != nil {
+			t.Fatal(e)
+		}
+
+		if got := sp.downside(result.Values); math.Abs(got-best) > 1e-9 {
+			t.Errorf("lambda %v: pit of %v blocks has objective %v, want %v", lambda, result.Pits[0].Blocks, got, best)
+		}
+
+		if result.Pits[0].Blocks != 2 {
+			t.Errorf("lambda %v: pit has %v blocks, want 2", lambda, result.Pits[0].Blocks)
+		}
+	}
+}
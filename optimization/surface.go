@@ -0,0 +1,279 @@
+package optimization
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	Surface_ASC = iota + 1
+	Surface_XYZ
+	Surface_OBJ
+	Surface_STL
+)
+
+type (
+	// The elevation of the pit bottom at the centroid of each column of the
+	// grid, x varying fastest. Columns that are not mined below it are at
+	// the topography, or the top of the grid if there is none.
+	surface struct {
+		grid *Grid
+		z    []float64
+	}
+)
+
+// The surface format of the file, from its extension (before any .gz)
+func surfaceFormat(path string) (int, error) {
+
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+
+	switch ext {
+	case ".asc":
+		return Surface_ASC, nil
+	case ".xyz":
+		return Surface_XYZ, nil
+	case ".obj":
+		return Surface_OBJ, nil
+	case ".stl":
+		return Surface_STL, nil
+	}
+
+	return 0, fmt.Errorf("ERROR: surface file %v must end in .asc, .xyz, .obj or .stl", path)
+}
+
+// The surface of one realization, mined where row is not 0. The
+// topography, if not nil, holds the elevation of each column.
+func newSurface(grid *Grid, row []int, topography []float64) *surface {
+
+	top := grid.MinZ + float64(grid.NumZ)*grid.SizZ
+	columns := grid.NumX * grid.NumY
+
+	this := &surface{grid: grid, z: make([]float64, columns)}
+
+	for c := range this.z {
+
+		this.z[c] = top
+		if topography != nil {
+			this.z[c] = topography[c]
+		}
+
+		// The lowest mined block, the blocks above it must be mined too.
+		// Air above the topography may be mined without lowering it.
+		for iz := 0; iz < grid.NumZ; iz++ {
+			if row[c+iz*columns] != 0 {
+				this.z[c] = math.Min(this.z[c], grid.MinZ+float64(iz)*grid.SizZ)
+				break
+			}
+		}
+	}
+
+	return this
+}
+
+// The centroid of the column at the pit bottom
+func (this *surface) point(ix, iy int) [3]float64 {
+	centroid := this.grid.blockCentroid(ix, iy, 0)
+	return [3]float64{centroid[0], centroid[1], this.z[ix+iy*this.grid.NumX]}
+}
+
+// Write one surface per row, numbering the files if there is more than one
+func writeSurfaceFiles(ctx context.Context, files *outputFiles, path string, grid *Grid, rows [][]int, topography []float64) error {
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	format, _ := surfaceFormat(path)
+
+	for r, row := range rows {
+
+		file := path
+		if len(rows) > 1 {
+			file = numberedFileName(path, r)
+		}
+
+		log.Infof("Writing the pit surface to %v", file)
+
+		s := newSurface(grid, row, topography)
+
+		e := files.write(ctx, file, func(writer io.Writer) error {
+			return s.write(ctx, writer, format)
+		})
+
+		if e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// The name with the numbers before the extension, pit.asc numbered 0 and
+// 2 becomes pit_0_2.asc
+func numberedFileName(path string, numbers ...int) string {
+
+	gz := ""
+	if strings.HasSuffix(path, ".gz") {
+		gz = ".gz"
+		path = strings.TrimSuffix(path, gz)
+	}
+
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(path, ext)
+
+	for _, n := range numbers {
+		name += fmt.Sprintf("_%v", n)
+	}
+
+	return name + ext + gz
+}
+
+func (this *surface) write(ctx context.Context, writer io.Writer, format int) error {
+
+	buffer := bufio.NewWriter(writer)
+
+	switch format {
+	case Surface_ASC:
+		this.writeAsc(buffer)
+	case Surface_XYZ:
+		this.writeXyz(buffer)
+	case Surface_OBJ:
+		this.writeObj(buffer)
+	case Surface_STL:
+		this.writeStl(buffer)
+	}
+
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+
+	if e := buffer.Flush(); e != nil {
+		e = fmt.Errorf("ERROR: failed writing surface: %v", e)
+		log.Error(e)
+		return &OutputError{e}
+	}
+
+	return nil
+}
+
+// ESRI ASCII grid, the rows from north to south. Cells that are not square
+// are given by dx and dy rather than cellsize.
+func (this *surface) writeAsc(w io.Writer) {
+
+	g := this.grid
+	corner := g.blockCentroid(0, 0, 0)
+
+	fmt.Fprintf(w, "ncols %v\n", g.NumX)
+	fmt.Fprintf(w, "nrows %v\n", g.NumY)
+	fmt.Fprintf(w, "xllcenter %v\n", corner[0])
+	fmt.Fprintf(w, "yllcenter %v\n", corner[1])
+
+	if g.SizX == g.SizY {
+		fmt.Fprintf(w, "cellsize %v\n", g.SizX)
+	} else {
+		fmt.Fprintf(w, "dx %v\n", g.SizX)
+		fmt.Fprintf(w, "dy %v\n", g.SizY)
+	}
+
+	for iy := g.NumY - 1; iy >= 0; iy-- {
+		for ix := 0; ix < g.NumX; ix++ {
+			if ix > 0 {
+				fmt.Fprint(w, " ")
+			}
+			fmt.Fprint(w, this.z[ix+iy*g.NumX])
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// One x y z line per column
+func (this *surface) writeXyz(w io.Writer) {
+	for iy := 0; iy < this.grid.NumY; iy++ {
+		for ix := 0; ix < this.grid.NumX; ix++ {
+			p := this.point(ix, iy)
+			fmt.Fprintf(w, "%v %v %v\n", p[0], p[1], p[2])
+		}
+	}
+}
+
+// The two triangles of each cell between four column centroids, counter
+// clockwise seen from above
+func (this *surface) triangles(each func(a, b, c [2]int)) {
+	for iy := 0; iy+1 < this.grid.NumY; iy++ {
+		for ix := 0; ix+1 < this.grid.NumX; ix++ {
+			each([2]int{ix, iy}, [2]int{ix + 1, iy}, [2]int{ix + 1, iy + 1})
+			each([2]int{ix, iy}, [2]int{ix + 1, iy + 1}, [2]int{ix, iy + 1})
+		}
+	}
+}
+
+// Wavefront OBJ, one vertex per column
+func (this *surface) writeObj(w io.Writer) {
+
+	fmt.Fprintln(w, "# ultpit pit surface")
+	fmt.Fprintln(w, "o pit")
+
+	for iy := 0; iy < this.grid.NumY; iy++ {
+		for ix := 0; ix < this.grid.NumX; ix++ {
+			p := this.point(ix, iy)
+			fmt.Fprintf(w, "v %v %v %v\n", p[0], p[1], p[2])
+		}
+	}
+
+	// Vertices are 1 indexed
+	vertex := func(c [2]int) int { return c[0] + c[1]*this.grid.NumX + 1 }
+
+	this.triangles(func(a, b, c [2]int) {
+		fmt.Fprintf(w, "f %v %v %v\n", vertex(a), vertex(b), vertex(c))
+	})
+}
+
+// ASCII STL
+func (this *surface) writeStl(w io.Writer) {
+
+	fmt.Fprintln(w, "solid pit")
+
+	this.triangles(func(a, b, c [2]int) {
+
+		p := [3][3]float64{this.point(a[0], a[1]), this.point(b[0], b[1]), this.point(c[0], c[1])}
+		n := normal(p[0], p[1], p[2])
+
+		fmt.Fprintf(w, "facet normal %v %v %v\n", n[0], n[1], n[2])
+		fmt.Fprintln(w, "  outer loop")
+		for _, v := range p {
+			fmt.Fprintf(w, "    vertex %v %v %v\n", v[0], v[1], v[2])
+		}
+		fmt.Fprintln(w, "  endloop")
+		fmt.Fprintln(w, "endfacet")
+	})
+
+	fmt.Fprintln(w, "endsolid pit")
+}
+
+// The unit normal of the triangle, by the right hand rule
+func normal(a, b, c [3]float64) [3]float64 {
+
+	u := [3]float64{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	v := [3]float64{c[0] - a[0], c[1] - a[1], c[2] - a[2]}
+
+	n := [3]float64{
+		u[1]*v[2] - u[2]*v[1],
+		u[2]*v[0] - u[0]*v[2],
+		u[0]*v[1] - u[1]*v[0],
+	}
+
+	if l := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2]); l > 0 {
+		for i := range n {
+			n[i] = n[i]/l + 0 // no negative zeros
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,129 @@
+package optimization
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A 3 by 2 grid of columns 3 blocks deep with its corner at 100, 200, 0.
+// The first column is mined to the bottom, the second one block and the
+// rest not at all.
+func surfaceTestGrid() (*Grid, []int) {
+
+	grid := &Grid{NumX: 3, NumY: 2, NumZ: 3, MinX: 100, MinY: 200, SizX: 10, SizY: 10, SizZ: 5}
+
+	row := make([]int, grid.gridCount())
+	for iz := 0; iz < 3; iz++ {
+		row[grid.gridIndex(0, 0, iz)] = 1
+	}
+	row[grid.gridIndex(1, 0, 2)] = 1
+
+	return grid, row
+}
+
+func TestSurfaceElevation(t *testing.T) {
+
+	grid, row := surfaceTestGrid()
+	s := newSurface(grid, row, nil)
+	want := []float64{0, 10, 15, 15, 15, 15}
+
+	for i, z := range want {
+		if s.z[i] != z {
+			t.Fatalf("elevations %v, want %v", s.z, want)
+		}
+	}
+
+	if p := s.point(1, 0); p != [3]float64{115, 205, 10} {
+		t.Errorf("point is %v, want [115 205 10]", p)
+	}
+
+	// Unmined columns are on the topography, and the second column only
+	// mines air above it
+	s = newSurface(grid, row, []float64{12, 8, 12, 9, 13, 14})
+	want = []float64{0, 8, 12, 9, 13, 14}
+
+	for i, z := range want {
+		if s.z[i] != z {
+			t.Fatalf("elevations %v on the topography, want %v", s.z, want)
+		}
+	}
+}
+
+func TestSurfaceFormats(t *testing.T) {
+
+	grid, row := surfaceTestGrid()
+	s := newSurface(grid, row, nil)
+
+	write := func(format int) string {
+		var buffer bytes.Buffer
+		if e := s.write(context.Background(), &buffer, format); e != nil {
+			t.Fatal(e)
+		}
+		return buffer.String()
+	}
+
+	// The rows from north to south
+	asc := "ncols 3\nnrows 2\nxllcenter 105\nyllcenter 205\ncellsize 10\n15 15 15\n0 10 15\n"
+
+	if got := write(Surface_ASC); got != asc {
+		t.Errorf("asc is %q, want %q", got, asc)
+	}
+
+	if got := strings.Split(write(Surface_XYZ), "\n"); len(got) != 7 || got[1] != "115 205 10" {
+		t.Errorf("xyz is %q", got)
+	}
+
+	// A vertex per column, two triangles per cell between them
+	obj := write(Surface_OBJ)
+
+	if v, f := strings.Count(obj, "\nv "), strings.Count(obj, "\nf "); v != 6 || f != 4 {
+		t.Errorf("obj has %v vertices and %v faces, want 6 and 4", v, f)
+	}
+
+	stl := write(Surface_STL)
+
+	if n := strings.Count(stl, "facet normal"); n != 4 {
+		t.Errorf("stl has %v facets, want 4", n)
+	}
+
+	// Counter clockwise seen from above, every facet faces up
+	for _, line := range strings.Split(stl, "\n") {
+		if fields := strings.Fields(line); len(fields) == 5 && fields[0] == "facet" {
+			if z, _ := strconv.ParseFloat(fields[4], 64); z <= 0 {
+				t.Errorf("facet faces down: %v", line)
+			}
+		}
+	}
+}
+
+func TestSurfaceFiles(t *testing.T) {
+
+	tests := []struct {
+		path   string
+		format int
+		name   string
+	}{
+		{"pit.asc", Surface_ASC, "pit_2.asc"},
+		{"out/pit.XYZ", Surface_XYZ, "out/pit_2.XYZ"},
+		{"pit.obj.gz", Surface_OBJ, "pit_2.obj.gz"},
+		{"pit.stl", Surface_STL, "pit_2.stl"},
+	}
+
+	for _, test := range tests {
+
+		if format, e := surfaceFormat(test.path); e != nil || format != test.format {
+			t.Errorf("%v: format %v, %v, want %v", test.path, format, e, test.format)
+		}
+
+		if name := numberedFileName(test.path, 2); name != test.name {
+			t.Errorf("%v: second file is %v, want %v", test.path, name, test.name)
+		}
+	}
+
+	if _, e := surfaceFormat("pit.dxf"); e == nil {
+		t.Error("pit.dxf accepted")
+	}
+}
@@ -0,0 +1,403 @@
+package optimization
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// The topography format of the file, from its extension (before any .gz)
+func topographyFormat(path string) (int, error) {
+
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+
+	switch ext {
+	case ".asc":
+		return Surface_ASC, nil
+	case ".xyz":
+		return Surface_XYZ, nil
+	}
+
+	return 0, fmt.Errorf("ERROR: topography file %v must end in .asc or .xyz", path)
+}
+
+// Read the current surface, an ESRI ASCII grid or x y z points, plain or
+// gzipped, and make the blocks above it air. Each column takes the cell of
+// the grid at its centroid, or the mean of the points in it. Columns with
+// neither take the nearest column that has.
+func (ctx *Parameters) readTopography(path string) error {
+
+	format, e := topographyFormat(path)
+
+	if e != nil {
+		log.Error(e)
+		return &ParameterError{e}
+	}
+
+	log.Infof("Reading the topography from %v", path)
+
+	f, e := os.Open(path)
+
+	if e != nil {
+		log.Errorf("Error: failed reading topography file %v: %v", path, e)
+		return &InputError{e}
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(path, ".gz") {
+		zr, e := gzip.NewReader(f)
+		if e != nil {
+			log.Errorf("Error: failed reading topography file %v: %v", path, e)
+			return &InputError{e}
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	var z []float64
+	var known []bool
+
+	if format == Surface_ASC {
+		z, known, e = readAscTopography(r, &ctx.Input.Grid)
+	} else {
+		z, known, e = readXyzTopography(r, &ctx.Input.Grid)
+	}
+
+	if e == nil {
+		e = fillColumns(z, known, ctx.Input.Grid.NumX, ctx.Input.Grid.NumY)
+	}
+
+	if e != nil {
+		e = fmt.Errorf("ERROR: failed reading topography file %v: %v", path, e)
+		log.Error(e)
+		return &InputError{e}
+	}
+
+	return ctx.Input.setTopography(z)
+}
+
+// The elevation of each column from an ESRI ASCII grid, the rows from north
+// to south, with the corner or the centre of the lower left cell
+func readAscTopography(r io.Reader, grid *Grid) ([]float64, []bool, error) {
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	s.Split(bufio.ScanWords)
+
+	header := make(map[string]float64)
+	var first string
+
+	for s.Scan() {
+
+		key := strings.ToLower(s.Text())
+
+		if _, e := strconv.ParseFloat(key, 64); e == nil {
+			first = key
+			break
+		}
+
+		if !s.Scan() {
+			break
+		}
+
+		v, e := strconv.ParseFloat(s.Text(), 64)
+
+		if e != nil {
+			return nil, nil, fmt.Errorf("invalid %v in the header: %v", key, s.Text())
+		}
+
+		header[key] = v
+	}
+
+	if e := s.Err(); e != nil {
+		return nil, nil, e
+	}
+
+	ncols, nrows := int(header["ncols"]), int(header["nrows"])
+
+	dx, dy := header["dx"], header["dy"]
+	if size, ok := header["cellsize"]; ok {
+		dx, dy = size, size
+	}
+
+	if ncols <= 0 || nrows <= 0 || dx <= 0 || dy <= 0 {
+		return nil, nil, fmt.Errorf("the header needs ncols, nrows and cellsize, or dx and dy")
+	}
+
+	// The lower left corner
+	x0, y0 := header["xllcorner"], header["yllcorner"]
+	if v, ok := header["xllcenter"]; ok {
+		x0 = v - dx/2
+	}
+	if v, ok := header["yllcenter"]; ok {
+		y0 = v - dy/2
+	}
+
+	nodata, hasNodata := header["nodata_value"]
+
+	cells := make([]float64, ncols*nrows)
+
+	for n := range cells {
+
+		word := first
+		if n > 0 || len(word) == 0 {
+			if !s.Scan() {
+				return nil, nil, fmt.Errorf("%v of %v cells", n, len(cells))
+			}
+			word = s.Text()
+		}
+
+		v, e := strconv.ParseFloat(word, 64)
+
+		if e != nil {
+			return nil, nil, fmt.Errorf("invalid cell %v: %v", n, word)
+		}
+
+		cells[n] = v
+	}
+
+	columns := grid.NumX * grid.NumY
+	z := make([]float64, columns)
+	known := make([]bool, columns)
+
+	for c := range z {
+
+		centroid := grid.blockCentroid(c%grid.NumX, c/grid.NumX, 0)
+		col := int(math.Floor((centroid[0] - x0) / dx))
+		row := nrows - 1 - int(math.Floor((centroid[1]-y0)/dy))
+
+		if col < 0 || col >= ncols || row < 0 || row >= nrows {
+			continue
+		}
+
+		if v := cells[col+row*ncols]; !hasNodata || v != nodata {
+			z[c] = v
+			known[c] = true
+		}
+	}
+
+	return z, known, nil
+}
+
+// The elevation of each column as the mean of the x y z points in it. The
+// values are separated by spaces or commas, lines starting with # and a
+// header line are skipped.
+func readXyzTopography(r io.Reader, grid *Grid) ([]float64, []bool, error) {
+
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanLines)
+
+	columns := grid.NumX * grid.NumY
+	z := make([]float64, columns)
+	count := make([]int, columns)
+
+	line := 0
+
+	for s.Scan() {
+
+		line++
+
+		text := strings.TrimSpace(s.Text())
+
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(text, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' })
+
+		var p [3]float64
+		var e error
+
+		if len(fields) < 3 {
+			e = fmt.Errorf("needs x, y and z")
+		}
+
+		for a := 0; e == nil && a < 3; a++ {
+			p[a], e = strconv.ParseFloat(fields[a], 64)
+		}
+
+		if e != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, nil, fmt.Errorf("line %v: %v", line, e)
+		}
+
+		ix := int(math.Floor((p[0] - grid.MinX) / grid.SizX))
+		iy := int(math.Floor((p[1] - grid.MinY) / grid.SizY))
+
+		if ix < 0 || ix >= grid.NumX || iy < 0 || iy >= grid.NumY {
+			continue
+		}
+
+		z[ix+iy*grid.NumX] += p[2]
+		count[ix+iy*grid.NumX]++
+	}
+
+	if e := s.Err(); e != nil {
+		return nil, nil, e
+	}
+
+	known := make([]bool, columns)
+
+	for c, n := range count {
+		if n > 0 {
+			z[c] /= float64(n)
+			known[c] = true
+		}
+	}
+
+	return z, known, nil
+}
+
+// Give each unknown column the elevation of the nearest known one, by
+// steps along x and y
+func fillColumns(z []float64, known []bool, nx, ny int) error {
+
+	var queue []int
+
+	for c, k := range known {
+		if k {
+			queue = append(queue, c)
+		}
+	}
+
+	if len(queue) == 0 {
+		return fmt.Errorf("no elevation over the grid")
+	} else if len(queue) < len(z) {
+		log.Warnf("The topography misses %v of %v columns, they take the nearest", len(z)-len(queue), len(z))
+	}
+
+	for n := 0; n < len(queue); n++ {
+
+		c := queue[n]
+		x, y := c%nx, c/nx
+
+		for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+			jx, jy := x+d[0], y+d[1]
+			if jx < 0 || jx >= nx || jy < 0 || jy >= ny {
+				continue
+			}
+			if j := jx + jy*nx; !known[j] {
+				z[j] = z[c]
+				known[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Keep the elevation of each column and make the blocks above it air,
+// worth nothing in every realization. The values are copied, not changed.
+func (this *Data) setTopography(z []float64) error {
+
+	if len(z) != this.Grid.NumX*this.Grid.NumY {
+		e := fmt.Errorf("ERROR: topography has %v columns, grid has %v", len(z), this.Grid.NumX*this.Grid.NumY)
+		log.Error(e)
+		return &InputError{e}
+	}
+
+	this.Topography = z
+
+	air := this.air()
+	count := 0
+
+	for _, v := range air {
+		if v {
+			count++
+		}
+	}
+
+	for r := range this.Ebv {
+		layer := make([]float64, len(this.Ebv[r]))
+		for i, v := range this.Ebv[r] {
+			if !air[i] {
+				layer[i] = v
+			}
+		}
+		this.Ebv[r] = layer
+	}
+
+	for r := range this.Tonnes {
+		for i, v := range air {
+			if v {
+				this.Tonnes[r][i] = 0
+				this.Ore[r][i] = false
+			}
+		}
+	}
+
+	log.Infof("Topography: %v blocks above the surface are air", count)
+
+	return nil
+}
+
+// The blocks with the centroid above the topography, nil if there is none
+func (this *Data) air() []bool {
+
+	if this.Topography == nil {
+		return nil
+	}
+
+	g := &this.Grid
+	columns := g.NumX * g.NumY
+	air := make([]bool, g.gridCount())
+
+	for i := range air {
+		air[i] = g.blockCentroid2(i)[2] > this.Topography[i%columns]
+	}
+
+	return air
+}
+
+// Take out of the mask the air blocks that need only air blocks above
+// them. They are worth nothing and need nothing, so the air fix adds them
+// back to the pits that need them. The mask must be closed.
+func (ctx *Parameters) stripAir(mask []bool) {
+
+	air := ctx.Input.air()
+
+	if air == nil {
+		return
+	}
+
+	keys, defs := ctx.Precedence.keys, ctx.Precedence.defs
+	count := 0
+
+	// The predecessors are above, at higher indices, so they are settled
+	// first going down
+	for i := len(mask) - 1; i >= 0; i-- {
+
+		if !air[i] || !mask[i] {
+			continue
+		}
+
+		if key := keys[i]; key != MISSING {
+			for _, off := range defs[key] {
+				if !air[i+off] {
+					air[i] = false
+					break
+				}
+			}
+		}
+
+		if air[i] {
+			mask[i] = false
+			count++
+		}
+	}
+
+	log.Infof("Removed %v air blocks from the mask", count)
+}
@@ -0,0 +1,142 @@
+package optimization
+
+import (
+	"strings"
+	"testing"
+)
+
+// A 3 by 2 grid of columns 3 blocks deep from the origin, the centroids at
+// 5, 15 and 25
+var topographyGrid = Grid{NumX: 3, NumY: 2, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}
+
+func checkColumns(t *testing.T, name string, z []float64, known []bool, want []float64, unknown ...int) {
+
+	missing := make(map[int]bool)
+	for _, c := range unknown {
+		missing[c] = true
+	}
+
+	for c := range want {
+		if known[c] == missing[c] || (known[c] && z[c] != want[c]) {
+			t.Errorf("%v: elevations %v known %v, want %v without %v", name, z, known, want, unknown)
+			return
+		}
+	}
+}
+
+// The rows run from north to south, each column taking the cell at its
+// centroid
+func TestAscTopography(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"corner", "ncols 3\nnrows 2\nxllcorner 0\nyllcorner 0\ncellsize 10\nNODATA_value -9999\n"},
+		{"center", "NCOLS 3\nNROWS 2\nXLLCENTER 5\nYLLCENTER 5\nDX 10\nDY 10\nNODATA_VALUE -9999\n"},
+	}
+
+	for _, test := range tests {
+
+		text := test.header + "20 -9999 12\n30 25 8\n"
+
+		z, known, e := readAscTopography(strings.NewReader(text), &topographyGrid)
+
+		if e != nil {
+			t.Fatalf("%v: %v", test.name, e)
+		}
+
+		checkColumns(t, test.name, z, known, []float64{30, 25, 8, 20, 0, 12}, 4)
+	}
+
+	bad := []string{
+		"ncols 3\nnrows 2\nxllcorner 0\nyllcorner 0\n1 2 3 4 5 6\n",
+		"ncols 3\nnrows 2\ncellsize 10\n1 2 3 4 5\n",
+		"ncols 3\nnrows 2\ncellsize x\n1 2 3 4 5 6\n",
+		"ncols 3\nnrows 2\ncellsize 10\n1 2 3 4 5 y\n",
+	}
+
+	for _, text := range bad {
+		if _, _, e := readAscTopography(strings.NewReader(text), &topographyGrid); e == nil {
+			t.Errorf("accepted %q", text)
+		}
+	}
+}
+
+// Each column is the mean of the points in it, after an optional header
+func TestXyzTopography(t *testing.T) {
+
+	text := "x,y,z\n# survey\n5,5,10\n6 6 20\n\n25\t15\t7\n99,99,1\n"
+
+	z, known, e := readXyzTopography(strings.NewReader(text), &topographyGrid)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	checkColumns(t, "xyz", z, known, []float64{15, 0, 0, 0, 0, 7}, 1, 2, 3, 4)
+
+	if _, _, e := readXyzTopography(strings.NewReader("1 1 1\n2 2\n"), &topographyGrid); e == nil {
+		t.Error("accepted a point without z")
+	}
+}
+
+// Unknown columns take the nearest known one
+func TestFillColumns(t *testing.T) {
+
+	z := []float64{15, 0, 0, 0, 0, 7}
+	known := []bool{true, false, false, false, false, true}
+
+	if e := fillColumns(z, known, 3, 2); e != nil {
+		t.Fatal(e)
+	}
+
+	checkColumns(t, "filled", z, known, []float64{15, 15, 7, 15, 7, 7})
+
+	if e := fillColumns(make([]float64, 4), make([]bool, 4), 2, 2); e == nil {
+		t.Error("filled columns without a known one")
+	}
+}
+
+// The blocks with their centroid above the surface are air, worth nothing
+// and weighing nothing
+func TestSetTopography(t *testing.T) {
+
+	data := &Data{Grid: topographyGrid}
+
+	n := data.Grid.gridCount()
+	data.Ebv = [][]float64{make([]float64, n)}
+	data.Tonnes = [][]float64{make([]float64, n)}
+	data.Ore = [][]bool{make([]bool, n)}
+
+	for i := 0; i < n; i++ {
+		data.Ebv[0][i] = 1
+		data.Tonnes[0][i] = 2
+		data.Ore[0][i] = true
+	}
+
+	original := data.Ebv[0]
+
+	if e := data.setTopography([]float64{30, 25, 8, 20, 20, 12}); e != nil {
+		t.Fatal(e)
+	}
+
+	air := make([]bool, n)
+	for _, b := range [][2]int{{2, 1}, {2, 2}, {5, 1}, {5, 2}, {3, 2}, {4, 2}} {
+		air[b[0]+b[1]*6] = true
+	}
+
+	for i := range air {
+		if air[i] != (data.Ebv[0][i] == 0) || air[i] != (data.Tonnes[0][i] == 0) || air[i] == data.Ore[0][i] {
+			t.Errorf("block %v: air %v, EBV %v, tonnes %v, ore %v", i, air[i], data.Ebv[0][i], data.Tonnes[0][i], data.Ore[0][i])
+		}
+	}
+
+	if original[n-1] != 1 {
+		t.Error("the values were changed, not copied")
+	}
+
+	if e := data.setTopography([]float64{1, 2}); e == nil {
+		t.Error("accepted a topography of 2 columns")
+	}
+}
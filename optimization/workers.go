@@ -0,0 +1,134 @@
+package optimization
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+// Solve count sets of condensed values, values(i) giving the i'th, with up
+// to ctx.workers engines at once. done is called with each solution in
+// order, whatever order they finish in, so the logs stay the same.
+func (ctx *Parameters) solveAll(
+	cx context.Context,
+	count int,
+	values func(i int) []float64,
+	pre *Precedence,
+	done func(i int, solution []bool),
+) error {
+
+	workers := ctx.workerCount(count, pre)
+
+	ctx.progress.reset(count, workers)
+
+	run, cancel := context.WithCancel(cx)
+	defer cancel()
+
+	solutions := make([][]bool, count)
+	errs := make([]error, count)
+	jobs := make(chan int)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	next := 0
+
+	// Hand on every solution that is ready and follows those handed on
+	deliver := func(i int, solution []bool) {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		solutions[i] = solution
+
+		for ; next < count && solutions[next] != nil; next++ {
+			done(next, solutions[next])
+			solutions[next] = nil
+		}
+	}
+
+	for w := 0; w < workers; w++ {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+
+				p := ctx.progress.begin(i + 1)
+				solution, e := ctx.solve(run, values(i), pre, p)
+				p.end()
+
+				if e != nil {
+					errs[i] = e
+					cancel()
+					continue
+				}
+
+				deliver(i, solution)
+			}
+		}()
+	}
+
+	for i := 0; i < count && run.Err() == nil; i++ {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	// The first failure, rather than the cancellations it caused
+	for _, e := range errs {
+		if e != nil && e != context.Canceled {
+			return e
+		}
+	}
+
+	return cx.Err()
+}
+
+// The number of engines to run at once, no more than fit in memory. The
+// limit is ctx.memoryLimit, or the runtime's (GOMEMLIMIT) if none is given.
+func (ctx *Parameters) workerCount(count int, pre *Precedence) int {
+
+	workers := ctx.workers
+
+	if workers > count {
+		workers = count
+	}
+
+	if workers <= 1 {
+		return 1
+	}
+
+	limit := ctx.memoryLimit
+	if limit <= 0 {
+		limit = debug.SetMemoryLimit(-1)
+	}
+
+	if limit > 0 && limit < math.MaxInt64 {
+
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+
+		available := limit - int64(stats.HeapAlloc)
+		each := engineMemory(&ctx.EngineParam, len(pre.keys), pre.statistics(0).Arcs)
+
+		if fit := int(available / each); fit < workers {
+			log.Infof("Memory for %v engines at once, of %v MB each", fit, each>>20)
+			workers = fit
+		}
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	log.Infof("Solving %v at once", workers)
+
+	return workers
+}
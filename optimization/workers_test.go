@@ -0,0 +1,87 @@
+package optimization
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Solving realizations at once finds the same pits, in the same order, as
+// solving them one after the other
+func TestWorkersAgreeWithSequential(t *testing.T) {
+
+	grid := Grid{NumX: 7, NumY: 6, NumZ: 4, SizX: 10, SizY: 10, SizZ: 10}
+	random := rand.New(rand.NewSource(3))
+
+	values := make([][]float64, 6)
+	for r := range values {
+		values[r] = make([]float64, grid.gridCount())
+		for i := range values[r] {
+			values[r][i] = float64(random.Intn(20) - 15)
+		}
+	}
+
+	model, e := NewBlockModel(grid, values...)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	opt := Options{
+		Precedence: Precedence{Method: BENCH, Slope: 45, NumBenches: 1},
+		Engine:     EngineParam{EngineType: Engine_LERCHSGROSSMANN},
+	}
+
+	sequential, e := Optimize(model, opt)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	opt.Workers = 4
+	concurrent, e := Optimize(model, opt)
+
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	for r := range values {
+
+		a, b := sequential.Pits[r], concurrent.Pits[r]
+
+		if a.Blocks != b.Blocks || a.Value != b.Value {
+			t.Errorf("realization %v: %v blocks worth %v, want %v worth %v", r, b.Blocks, b.Value, a.Blocks, a.Value)
+			continue
+		}
+
+		for i := range a.Selected {
+			if a.Selected[i] != b.Selected[i] {
+				t.Errorf("realization %v: block %v differs", r, i)
+				break
+			}
+		}
+	}
+}
+
+// There are never more workers than solves, nor fewer than one
+func TestWorkerCount(t *testing.T) {
+
+	pre := &Precedence{}
+
+	tests := []struct {
+		workers, count, want int
+	}{
+		{0, 5, 1},
+		{1, 5, 1},
+		{4, 2, 2},
+		{4, 8, 4},
+	}
+
+	for _, test := range tests {
+
+		ctx := &Parameters{workers: test.workers}
+
+		if got := ctx.workerCount(test.count, pre); got != test.want {
+			t.Errorf("%v workers for %v solves: got %v, want %v", test.workers, test.count, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package optimization
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+type (
+	// The slope, or slope sectors, of one geotechnical zone
+	GeotechZone struct {
+		Code    int     `json:"code"`
+		Slope   float64 `json:"slope"`
+		Sectors Sectors `json:"sectors"`
+	}
+
+	// The zone of each block comes from a 1 indexed column of a GSLIB input,
+	// from a file with one code per line in grid order, or from Codes when
+	// the block model is built in memory.
+	ZoneParam struct {
+		Column int           `json:"column"`
+		File   string        `json:"file"`
+		Slopes []GeotechZone `json:"slopes"`
+		Codes  []int         `json:"-"`
+	}
+)
+
+func (this *ZoneParam) check() error {
+
+	sources := 0
+	for _, given := range []bool{this.Column > 0, len(this.File) > 0, len(this.Codes) > 0} {
+		if given {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		return fmt.Errorf("ERROR: zones need exactly one of a column, a file or the codes")
+	} else if len(this.Slopes) == 0 {
+		return fmt.Errorf("ERROR: at least one zone slope is required")
+	}
+
+	seen := make(map[int]bool)
+
+	for _, z := range this.Slopes {
+
+		var e error
+
+		if seen[z.Code] {
+			e = fmt.Errorf("ERROR: zone %v supplied more than once", z.Code)
+		} else if len(z.Sectors) > 0 {
+			e = z.Sectors.check()
+		} else {
+			e = checkSlope(z.Slope)
+		}
+
+		if e != nil {
+			return fmt.Errorf("%v (zone %v)", e, z.Code)
+		}
+
+		seen[z.Code] = true
+	}
+
+	return nil
+}
+
+// Read the zone codes of the blocks
+func (this *ZoneParam) initialize(data *Data, infile string) error {
+
+	var e error
+
+	if this.Column > 0 {
+		if data.Type != Input_GSLIB {
+			e = &ParameterError{fmt.Errorf("ERROR: a zone column needs a GSLIB input, type %v", Input_GSLIB)}
+		} else {
+			var columns [][][]float64
+			if columns, e = data.readGslib(infile, []int{this.Column}); e == nil {
+				// Zones are the same for every realization
+				this.Codes = toCodes(columns[0][0])
+			}
+		}
+	} else {
+		this.Codes, e = readZoneFile(this.File, data.Grid.gridCount())
+	}
+
+	if e != nil {
+		log.Error(e)
+	}
+
+	return inputError(e)
+}
+
+func toCodes(values []float64) []int {
+	codes := make([]int, len(values))
+	for i, v := range values {
+		codes[i] = int(math.Round(v))
+	}
+	return codes
+}
+
+// Read one zone code per line, the file may be gzipped
+func readZoneFile(file string, cnt int) ([]int, error) {
+
+	f, e := os.Open(file)
+
+	if e != nil {
+		return nil, fmt.Errorf("Error: failed reading zone file %v: %v", file, e)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(file, ".gz") {
+		zr, e := gzip.NewReader(f)
+		if e != nil {
+			return nil, fmt.Errorf("Error: failed reading zone file %v: %v", file, e)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanLines)
+
+	values := make([]float64, 0, cnt)
+
+	for s.Scan() {
+
+		text := strings.TrimSpace(s.Text())
+
+		if len(text) == 0 {
+			continue
+		}
+
+		v, e := strconv.ParseFloat(text, 64)
+
+		if e != nil {
+			return nil, fmt.Errorf("Error: failed reading zone file %v: %v", file, e)
+		}
+
+		values = append(values, v)
+	}
+
+	if e = s.Err(); e != nil {
+		return nil, fmt.Errorf("Error: failed reading zone file %v: %v", file, e)
+	} else if len(values) != cnt {
+		return nil, fmt.Errorf("ERROR: zone file %v has %v values, grid has %v blocks", file, len(values), cnt)
+	}
+
+	return toCodes(values), nil
+}
+
+// One template per zone, each block uses the template of its zone
+func (this *Precedence) genZones(ctx *Parameters, mask []bool) error {
+
+	pg := &ctx.Input.Grid
+	zones := &this.Zones
+
+	if len(zones.Codes) != pg.gridCount() {
+		return fmt.Errorf("ERROR: %v zone codes, grid has %v blocks", len(zones.Codes), pg.gridCount())
+	}
+
+	templates := make(map[int]*Template)
+
+	for _, z := range zones.Slopes {
+
+		log.Infof("Zone %v", z.Code)
+
+		if len(z.Sectors) > 0 {
+			templates[z.Code] = this.sectorTemplate(pg, z.Sectors)
+		} else {
+			templates[z.Code] = this.benchTemplate(pg, z.Slope)
+		}
+	}
+
+	// A zone without a slope is given the first slope here, and is then
+	// an error if the block has predecessors. Blocks without any, outside
+	// the mask and its predecessors or on the top bench, may be in any zone.
+	this.applyTemplates(pg, mask, func(loc int) *Template {
+		if tmpl, ok := templates[zones.Codes[loc]]; ok {
+			return tmpl
+		}
+		return templates[zones.Slopes[0].Code]
+	})
+
+	for i, key := range this.keys {
+		if _, ok := templates[zones.Codes[i]]; !ok && key != MISSING {
+			return fmt.Errorf("ERROR: block %v is in zone %v, which has no slope", i, zones.Codes[i])
+		}
+	}
+
+	return nil
+}
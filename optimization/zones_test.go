@@ -0,0 +1,118 @@
+package optimization
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write a GSLIB file of the grid with an EBV and a zone column
+func writeZoneGslib(t *testing.T, grid Grid) string {
+
+	var b strings.Builder
+
+	fmt.Fprintln(&b, "zones")
+	fmt.Fprintln(&b, "2")
+	fmt.Fprintln(&b, "ebv")
+	fmt.Fprintln(&b, "zone")
+
+	for i := 0; i < grid.gridCount(); i++ {
+		fmt.Fprintf(&b, "%v %v\n", float64(i%3)-1, 1+i%2)
+	}
+
+	path := filepath.Join(t.TempDir(), "zones.txt")
+
+	if e := os.WriteFile(path, []byte(b.String()), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	return path
+}
+
+// Reading the zone column reads the file a second time, the origin must
+// still only move half a block
+func TestZoneColumnGridOrigin(t *testing.T) {
+
+	grid := Grid{
+		NumX: 3, NumY: 2, NumZ: 2,
+		MinX: 105, MinY: 210, MinZ: 5,
+		SizX: 10, SizY: 20, SizZ: 10,
+	}
+
+	ctx := &Parameters{
+		Input: Data{Type: Input_GSLIB, Grid: grid, EbvCols: 1},
+		Precedence: Precedence{
+			Method: ZONES,
+			Zones: ZoneParam{
+				Column: 2,
+				Slopes: []GeotechZone{{Code: 1, Slope: 45}, {Code: 2, Slope: 45}},
+			},
+		},
+	}
+
+	if e := ctx.readInput(writeZoneGslib(t, grid)); e != nil {
+		t.Fatal(e)
+	}
+
+	g := &ctx.Input.Grid
+
+	if g.MinX != 100 || g.MinY != 200 || g.MinZ != 0 {
+		t.Errorf("origin is %v %v %v, want 100 200 0", g.MinX, g.MinY, g.MinZ)
+	}
+
+	if c := g.blockCentroid(0, 0, 0); c != [3]float64{105, 210, 5} {
+		t.Errorf("first centroid is %v, want [105 210 5]", c)
+	}
+
+	if len(ctx.Precedence.Zones.Codes) != grid.gridCount() || ctx.Precedence.Zones.Codes[1] != 2 {
+		t.Errorf("zone codes %v", ctx.Precedence.Zones.Codes)
+	}
+}
+
+// Waste blocks outside the naive mask that are predecessors of the mask
+// need a zone with a slope too
+func TestZoneUnknownPredecessor(t *testing.T) {
+
+	grid := Grid{NumX: 3, NumY: 3, NumZ: 3, SizX: 10, SizY: 10, SizZ: 10}
+	n := grid.gridCount()
+
+	ebv := make([]float64, n)
+	codes := make([]int, n)
+
+	for i := range ebv {
+		ebv[i] = -1
+		codes[i] = 1
+		if grid.gridIz(i) == 1 {
+			codes[i] = 9
+		}
+	}
+
+	// Only the centre of the bottom bench is in the naive mask
+	ebv[grid.gridIndex(1, 1, 0)] = 10
+
+	ctx := &Parameters{
+		Input: Data{Grid: grid, Ebv: [][]float64{ebv}},
+		Precedence: Precedence{
+			Method:     ZONES,
+			NumBenches: 1,
+			Zones:      ZoneParam{Codes: codes, Slopes: []GeotechZone{{Code: 1, Slope: 45}}},
+		},
+	}
+
+	e := ctx.Precedence.init(ctx, ctx.generateMask())
+
+	var input *InputError
+	if !errors.As(e, &input) {
+		t.Fatalf("got %v, want an InputError for zone 9", e)
+	}
+
+	// With a slope for zone 9 it solves
+	ctx.Precedence.Zones.Slopes = append(ctx.Precedence.Zones.Slopes, GeotechZone{Code: 9, Slope: 45})
+
+	if e := ctx.Precedence.init(ctx, ctx.generateMask()); e != nil {
+		t.Fatal(e)
+	}
+}